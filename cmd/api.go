@@ -16,7 +16,7 @@ func startAPIServer(port int) {
 	s := api.NewAPIServer()
 
 	s.Route(router.APIRoute)
-	s.Start(port)
+	s.Start(port, shutdownTimeout("api_server"))
 }
 
 // apiCmd represents the api command
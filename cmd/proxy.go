@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"log"
+	"time"
 
 	"github.com/chatmcp/mcprouter/router"
 	"github.com/chatmcp/mcprouter/service/proxy"
@@ -11,12 +12,20 @@ import (
 
 var proxyConfigFile string
 
+// defaultIdleTimeout is how long a session may stay idle before it is closed, in seconds
+const defaultIdleTimeout = 1800
+
+// defaultClientIdleTTL is how long a shared client may stay unused before it is closed, in seconds
+const defaultClientIdleTTL = 600
+
 // startProxyServer starts the sse server
-func startProxyServer(port int) {
+func startProxyServer(port int, idleTimeout time.Duration, clientIdleTTL time.Duration) {
 	s := proxy.NewSSEServer()
+	s.CloseIdleSessions(idleTimeout)
+	s.CloseIdleClients(clientIdleTTL)
 
 	s.Route(router.ProxyRoute)
-	s.Start(port)
+	s.Start(port, shutdownTimeout("proxy_server"))
 }
 
 // proxyCmd represents the proxy command
@@ -35,7 +44,19 @@ var proxyCmd = &cobra.Command{
 			port = 8025
 		}
 
-		startProxyServer(port)
+		// a negative idle timeout keeps idle sessions open
+		idleTimeout := viper.GetInt("proxy_server.idle_timeout")
+		if idleTimeout == 0 {
+			idleTimeout = defaultIdleTimeout
+		}
+
+		// a negative ttl keeps the clients of the servers with no idle_ttl
+		clientIdleTTL := viper.GetInt("proxy_server.client_idle_ttl")
+		if clientIdleTTL == 0 {
+			clientIdleTTL = defaultClientIdleTTL
+		}
+
+		startProxyServer(port, time.Duration(idleTimeout)*time.Second, time.Duration(clientIdleTTL)*time.Second)
 	},
 }
 
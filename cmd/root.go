@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/chatmcp/mcprouter/util"
 	"github.com/spf13/cobra"
@@ -66,6 +67,19 @@ func Init() error {
 	return nil
 }
 
+// defaultShutdownTimeout is how long a server waits for in-flight requests on shutdown, in seconds
+const defaultShutdownTimeout = 30
+
+// shutdownTimeout returns the shutdown timeout configured for the server section
+func shutdownTimeout(section string) time.Duration {
+	timeout := viper.GetInt(section + ".shutdown_timeout")
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	return time.Duration(timeout) * time.Second
+}
+
 func init() {
 	rootCmd.PersistentFlags().StringP("version", "v", "0.0.1", "version")
 }
@@ -10,9 +10,18 @@ CREATE TABLE IF NOT EXISTS servers (
     content TEXT,
     server_key VARCHAR(255) UNIQUE NOT NULL,
     server_url VARCHAR(255) NOT NULL,
-    config_name VARCHAR(255) NOT NULL
+    config_name VARCHAR(255) NOT NULL,
+    command TEXT NOT NULL DEFAULT '',
+    args TEXT NOT NULL DEFAULT '',
+    env TEXT NOT NULL DEFAULT '',
+    cwd VARCHAR(255) NOT NULL DEFAULT ''
 );
 
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS command TEXT NOT NULL DEFAULT '';
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS args TEXT NOT NULL DEFAULT '';
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS env TEXT NOT NULL DEFAULT '';
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS cwd VARCHAR(255) NOT NULL DEFAULT '';
+
 CREATE TABLE IF NOT EXISTS tools (
     uuid VARCHAR(255) NOT NULL PRIMARY KEY,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
@@ -40,7 +40,7 @@ func GetServer(c echo.Context) error {
 		}
 		defer client.Close()
 
-		result, err := client.ListTools()
+		result, err := client.ListTools(ctx.Request().Context())
 		if err != nil {
 			return ctx.RespErr(err)
 		}
@@ -43,7 +43,7 @@ func CallTool(c echo.Context) error {
 
 	proxyInfo.RequestParams = requestParams
 
-	callToolResult, err := client.CallTool(requestParams)
+	callToolResult, err := client.CallTool(ctx.Request().Context(), requestParams)
 	if err != nil {
 		return ctx.RespErr(err)
 	}
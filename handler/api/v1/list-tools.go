@@ -31,7 +31,7 @@ func ListTools(c echo.Context) error {
 	proxyInfo := ctx.ProxyInfo()
 	proxyInfo.RequestMethod = jsonrpc.MethodListTools
 
-	result, err := client.ListTools()
+	result, err := client.ListTools(ctx.Request().Context())
 	if err != nil {
 		return ctx.RespErr(err)
 	}
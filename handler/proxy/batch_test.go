@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+	"github.com/chatmcp/mcprouter/service/proxy"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"github.com/tidwall/gjson"
+)
+
+func TestMCPBatch(t *testing.T) {
+	viper.Set("mcp_servers.batch.command", "true")
+
+	var e *echo.Echo
+	proxy.NewSSEServer().Route(func(router *echo.Echo) {
+		e = router
+		router.Any("/mcp/:key", MCP)
+	})
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantIDs    []string // raw ids of the responses, in order
+		wantCode   int      // error code of every response
+	}{
+		{"empty batch", `[]`, http.StatusBadRequest, []string{"null"}, jsonrpc.ErrorInvalidRequest.Code},
+		{"invalid json", `[{"jsonrpc":`, http.StatusBadRequest, []string{"null"}, jsonrpc.ErrorParseError.Code},
+		{"invalid elements", `[1,{"jsonrpc":"2.0","id":"a"},{"jsonrpc":"2.0","id":3,"method":5}]`, http.StatusOK, []string{"null", `"a"`, "3"}, jsonrpc.ErrorInvalidRequest.Code},
+		{"initialize in a batch", `[{"jsonrpc":"2.0","id":1,"method":"initialize"}]`, http.StatusBadRequest, []string{"1"}, jsonrpc.ErrorInvalidRequest.Code},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/mcp/batch", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept", "application/json, text/event-stream")
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			body := gjson.Parse(rec.Body.String())
+			responses := body.Array()
+			if !body.IsArray() {
+				responses = []gjson.Result{body}
+			}
+			if len(responses) != len(tt.wantIDs) {
+				t.Fatalf("got %d responses, want %d: %s", len(responses), len(tt.wantIDs), rec.Body)
+			}
+			for i, response := range responses {
+				if got := response.Get("id").Raw; got != tt.wantIDs[i] {
+					t.Errorf("response %d id = %s, want %s", i, got, tt.wantIDs[i])
+				}
+				if got := int(response.Get("error.code").Int()); got != tt.wantCode {
+					t.Errorf("response %d error code = %d, want %d", i, got, tt.wantCode)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+	"github.com/chatmcp/mcprouter/service/proxy"
+)
+
+func TestCancelRequest(t *testing.T) {
+	tests := []struct {
+		name         string
+		id           string // raw id of the request in flight
+		notification string
+		want         bool
+	}{
+		{"number id", `1`, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":1}}`, true},
+		{"string id", `"a"`, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":"a"}}`, true},
+		{"string id does not cancel a number id", `1`, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":"1"}}`, false},
+		{"other id", `1`, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":2}}`, false},
+		{"no params", `1`, `{"jsonrpc":"2.0","method":"notifications/cancelled"}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := proxy.NewSSESession(nil, nil, &proxy.ProxyInfo{SessionID: "s"})
+			defer session.Close()
+
+			request, err := jsonrpc.UnmarshalRequest([]byte(`{"jsonrpc":"2.0","id":` + tt.id + `,"method":"tools/call"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, release, err := session.RequestContext(context.Background(), request.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer release()
+
+			notification, err := jsonrpc.UnmarshalRequest([]byte(tt.notification))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cancelRequest(session, notification)
+
+			if got := ctx.Err() != nil; got != tt.want {
+				t.Errorf("request cancelled = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,21 +1,31 @@
 package proxy
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+	"github.com/chatmcp/mcprouter/service/mcpclient"
 	"github.com/chatmcp/mcprouter/service/mcpserver"
 	"github.com/chatmcp/mcprouter/service/proxy"
 	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
 )
 
 // Constants for better maintainability
 const (
-	AcceptJSON         = "application/json"
-	AcceptEventStream  = "text/event-stream"
-	HeaderMcpSessionID = "Mcp-Session-Id"
-	HeaderXRequestID   = "X-Request-ID"
-	HeaderXRequestFrom = "X-Request-From"
+	AcceptJSON               = "application/json"
+	AcceptEventStream        = "text/event-stream"
+	HeaderMcpSessionID       = "Mcp-Session-Id"
+	HeaderXRequestFrom       = "X-Request-From"
+	HeaderXRequestID         = "X-Request-ID"
+	HeaderLastEventID        = "Last-Event-ID"
+	HeaderMcpProtocolVersion = "MCP-Protocol-Version"
+	HeaderXForwardedBy       = "X-Mcprouter-Forwarded-By"
 
 	MethodInitialize = "initialize"
 	MethodToolsCall  = "tools/call"
@@ -23,14 +33,36 @@ const (
 
 // HTTP response messages
 const (
-	ErrFailedSSEContext    = "Failed to get SSE context"
-	ErrKeyRequired         = "Key is required"
-	ErrInvalidServerConfig = "Invalid server config"
-	ErrInvalidSessionID    = "Invalid session ID"
-	ErrMethodNotAllowed    = "Method Not Allowed"
-	ErrGETRequiresSSE      = "GET requests require text/event-stream Accept header"
+	ErrFailedSSEContext           = "Failed to get SSE context"
+	ErrKeyRequired                = "Key is required"
+	ErrInvalidServerConfig        = "Invalid server config"
+	ErrInvalidSessionID           = "Invalid session ID"
+	ErrSessionNotFound            = "Session not found"
+	ErrMethodNotAllowed           = "Method Not Allowed"
+	ErrGETRequiresSSE             = "GET requests require text/event-stream Accept header"
+	ErrUnsupportedProtocolVersion = "Unsupported protocol version"
+	ErrShuttingDown               = "Server is shutting down"
 )
 
+// ErrorServerRequestSession is returned to a shared backend for a server request that cannot be tied to one session
+var ErrorServerRequestSession = jsonrpc.NewError(jsonrpc.ErrorInvalidRequest.Code, "Server request cannot be tied to a session", nil)
+
+// ErrorDuplicateRequestID is returned for a client request whose id is already in flight in its session
+var ErrorDuplicateRequestID = jsonrpc.NewError(jsonrpc.ErrorInvalidRequest.Code, "Request id is already in flight", nil)
+
+// defaultHeartbeatInterval is the interval of the heartbeats sent on idle SSE streams, in seconds
+const defaultHeartbeatInterval = 30
+
+// heartbeatInterval returns the interval of the heartbeats that keep SSE streams open through proxies
+func heartbeatInterval() time.Duration {
+	interval := viper.GetInt("proxy_server.heartbeat_interval")
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+
+	return time.Duration(interval) * time.Second
+}
+
 // validateKeyAndConfig validates key parameter and retrieves server configuration
 func validateKeyAndConfig(c echo.Context) (string, *mcpserver.ServerConfig, error) {
 	// Validate key parameter
@@ -71,3 +103,188 @@ func createProxyInfo(key string, serverConfig *mcpserver.ServerConfig) *proxy.Pr
 		ServerCommandHash:  serverConfig.CommandHash,
 	}
 }
+
+// cancelRequest cancels the in-flight request the cancelled notification of the client refers to,
+// the client sends the cancellation upstream with the upstream request id
+func cancelRequest(session *proxy.SSESession, request *jsonrpc.Request) {
+	params, ok := request.Params.(map[string]interface{})
+	if !ok || session == nil {
+		return
+	}
+
+	if session.Cancel(params["requestId"]) {
+		log.Printf("Cancelled request %v of session %s", params["requestId"], session.ID())
+	}
+}
+
+// forwardError returns the JSON-RPC error for a request that could not be forwarded,
+// the tail of the stderr of a failed backend and the cause it tells are returned in its data
+func forwardError(err error) *jsonrpc.Error {
+	if errors.Is(err, proxy.ErrDuplicateRequestID) {
+		return ErrorDuplicateRequestID
+	}
+
+	jerr := jsonrpc.ErrorProxyError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		jerr = jsonrpc.ErrorRequestTimeout
+	case errors.Is(err, context.Canceled):
+		jerr = jsonrpc.ErrorRequestCancelled
+	case errors.Is(err, mcpclient.ErrBackendRestarting):
+		jerr = jsonrpc.ErrorServerRestarting
+	}
+
+	var berr *mcpclient.BackendError
+	if errors.As(err, &berr) {
+		data := map[string]interface{}{
+			"error":  berr.Error(),
+			"stderr": berr.Stderr,
+		}
+		if berr.Cause != "" {
+			data["cause"] = berr.Cause
+		}
+		if berr.Violation != "" {
+			data["violation"] = berr.Violation
+		}
+		return jsonrpc.NewError(jerr.Code, jerr.Message, data)
+	}
+
+	return jerr
+}
+
+// requestAborted reports whether the request timed out, was cancelled or hit a backend being restarted,
+// the client itself is fine in that case
+func requestAborted(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, mcpclient.ErrBackendRestarting)
+}
+
+// getSessionClient returns the dedicated client of a session whose server does not share its process.
+// The backend process is started on initialize and lives as long as the session.
+func getSessionClient(ctx *proxy.SSEContext, session *proxy.SSESession, request *jsonrpc.Request) (mcpclient.Client, error) {
+	if client := session.Client(); client != nil {
+		return client, nil
+	}
+
+	if request.Method != MethodInitialize {
+		return nil, errors.New("session client is not initialized")
+	}
+
+	client, err := newClient(ctx, session.ServerConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Error(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	// Notifications and requests of a dedicated process belong to its session only
+	client.OnNotification(func(_ string, message []byte) {
+		session.SendMessage(string(message))
+	})
+	client.OnRequest(func(_ string, message []byte) ([]byte, error) {
+		return session.Request(message)
+	})
+
+	session.SetClient(client)
+
+	return client, nil
+}
+
+// sharedClientLocks holds a mutex per server key, so only one backend is connected for the first sessions of a key
+var sharedClientLocks sync.Map // map[string]*sync.Mutex
+
+// sharedClient returns the shared client of the server key, connecting it when there is none
+func sharedClient(ctx *proxy.SSEContext, key string, serverConfig *mcpserver.ServerConfig) (mcpclient.Client, error) {
+	if client := ctx.GetClient(key); client != nil {
+		return client, nil
+	}
+
+	// Concurrent callers wait for the first one to connect instead of starting a backend each
+	lock, _ := sharedClientLocks.LoadOrStore(key, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	if client := ctx.GetClient(key); client != nil {
+		return client, nil
+	}
+
+	client, err := newClient(ctx, serverConfig)
+	if err != nil {
+		log.Printf("Failed to connect to MCP server: %v", err)
+		return nil, err
+	}
+
+	if err := client.Error(); err != nil {
+		log.Printf("MCP server run failed: %v", err)
+		client.Close()
+		return nil, err
+	}
+
+	// Route notifications and server requests to their sessions
+	routeSharedClient(ctx, key, client)
+
+	ctx.StoreClient(key, client, serverConfig)
+
+	return client, nil
+}
+
+// newClient connects to the server, the members of a composite server that share their process
+// use the shared client of their server key
+func newClient(ctx *proxy.SSEContext, serverConfig *mcpserver.ServerConfig) (mcpclient.Client, error) {
+	if !serverConfig.Composite() {
+		return mcpclient.NewClient(serverConfig)
+	}
+
+	// The composite outlives the request, it only uses the stores of the context
+	stores := ctx.Detach()
+	return mcpclient.NewCompositeClient(serverConfig, func(key string, memberConfig *mcpserver.ServerConfig) (mcpclient.Client, error) {
+		return sharedClient(stores, key, memberConfig)
+	})
+}
+
+// routeSharedClient routes the notifications and server requests of the shared client of the server key
+// to the sessions they are meant for
+func routeSharedClient(ctx *proxy.SSEContext, key string, client mcpclient.Client) {
+	client.OnNotification(func(sessionID string, message []byte) {
+		log.Printf("Received notification for session %s: %s", sessionID, message)
+		ctx.RouteNotification(key, sessionID, string(message))
+	})
+
+	// Server requests go to the session whose request they come with, never to a guessed one
+	client.OnRequest(func(sessionID string, message []byte) ([]byte, error) {
+		session := ctx.GetSession(sessionID)
+		if sessionID == "" || session == nil || !session.Uses(key) {
+			log.Printf("Rejecting server request of %s not tied to a session: %s", key, message)
+			return nil, ErrorServerRequestSession
+		}
+		log.Printf("Routing server request to session %s: %s", session.ID(), message)
+		return session.Request(message)
+	})
+}
+
+// trackSubscription records the resource subscriptions of the session, updates of a resource of a shared backend
+// are only sent to its subscribers. It is called before the request is forwarded, as the backend may send updates
+// before its response, then with the response, to remove the subscriptions the backend rejected.
+func trackSubscription(session *proxy.SSESession, request *jsonrpc.Request, response *jsonrpc.Response) {
+	if session == nil {
+		return
+	}
+
+	params, ok := request.Params.(map[string]interface{})
+	if !ok {
+		return
+	}
+	uri, _ := params["uri"].(string)
+
+	switch {
+	case request.Method == jsonrpc.MethodSubscribeResource && response == nil:
+		session.Subscribe(uri)
+	case request.Method == jsonrpc.MethodSubscribeResource && response.Error != nil:
+		session.Unsubscribe(uri)
+	case request.Method == jsonrpc.MethodUnsubscribeResource && response == nil:
+		session.Unsubscribe(uri)
+	}
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chatmcp/mcprouter/service/mcpclient"
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+	"github.com/chatmcp/mcprouter/service/proxy"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSharedClientConnectsOnce(t *testing.T) {
+	launches := filepath.Join(t.TempDir(), "launches")
+	serverConfig := &mcpserver.ServerConfig{
+		ServerKey:    "once",
+		Command:      "sh",
+		Args:         []string{"-c", "echo >> " + launches + "; sleep 1"},
+		ShareProcess: true,
+	}
+
+	// the stores of the server are only reachable from a request
+	var ctx *proxy.SSEContext
+	proxy.NewSSEServer().Route(func(e *echo.Echo) {
+		e.GET("/", func(c echo.Context) error {
+			ctx = proxy.GetSSEContext(c).Detach()
+			return nil
+		})
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+
+	const callers = 8
+	clients := make([]mcpclient.Client, callers)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, err := sharedClient(ctx, "once", serverConfig)
+			if err != nil {
+				t.Error(err)
+			}
+			clients[i] = client
+		}()
+	}
+	wg.Wait()
+
+	for _, client := range clients[1:] {
+		if client != clients[0] {
+			t.Fatal("concurrent callers got different clients")
+		}
+	}
+	clients[0].Close()
+
+	data, err := os.ReadFile(launches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 1 {
+		t.Errorf("backend started %d times, want 1", n)
+	}
+}
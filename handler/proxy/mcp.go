@@ -1,10 +1,13 @@
 package proxy
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/chatmcp/mcprouter/model"
@@ -24,6 +27,11 @@ func MCP(c echo.Context) error {
 		return err
 	}
 
+	// Sessions held by another replica are handled there
+	if routed, err := routeToOwner(c, ctx, c.Request().Header.Get(HeaderMcpSessionID)); routed {
+		return err
+	}
+
 	switch c.Request().Method {
 	case http.MethodOptions:
 		return handleCORS(c)
@@ -42,7 +50,7 @@ func MCP(c echo.Context) error {
 func handleCORS(c echo.Context) error {
 	response := c.Response()
 	response.Header().Set("Access-Control-Allow-Origin", "*")
-	response.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, Authorization, Mcp-Session-Id")
+	response.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, Authorization, Mcp-Session-Id, MCP-Protocol-Version, Last-Event-ID")
 	response.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
 	response.Header().Set("Access-Control-Max-Age", "86400")
 	return c.NoContent(http.StatusOK)
@@ -51,52 +59,205 @@ func handleCORS(c echo.Context) error {
 // processRequest handles POST requests for MCP communication
 func processRequest(c echo.Context, ctx *proxy.SSEContext) error {
 	// Parse and validate request
-	key, serverConfig, request, err := parseRequest(c, ctx)
-	if err != nil {
+	key, serverConfig, requests, batch, err := parseRequest(c, ctx)
+	if err != nil || c.Response().Committed {
 		return err
 	}
 
-	// Handle notification requests early
-	if request.Result != nil || request.Error != nil {
+	if batch {
+		return processBatch(c, ctx, key, serverConfig, requests)
+	}
+
+	request := requests[0]
+
+	// Route client responses to server-initiated requests
+	if request.IsResponse() {
+		respondServerRequest(c, ctx, key, request)
 		return ctx.JSONRPCAcceptResponse(nil)
 	}
 
 	// Setup session and proxy info
 	proxyInfo, sessionID, err := setupSession(c, ctx, key, serverConfig, request)
-	if err != nil {
+	if err != nil || c.Response().Committed {
 		return err
 	}
 
+	// Relay messages of the session live while the request is in flight
+	session := restoreSession(ctx, key, serverConfig, sessionID)
+	if session != nil && request.ID != nil && request.Method != MethodInitialize && useEventStream(c) {
+		return streamRequest(ctx, session, key, serverConfig, proxyInfo, request)
+	}
+
 	// Forward request to MCP server
-	response, err := forwardRequest(ctx, key, serverConfig, request)
+	// The response is lost when the client goes away, so the request is cancelled with it
+	response, err := forwardRequest(ctx, c.Request().Context(), session, key, serverConfig, request)
 	if err != nil {
-		return err
+		return ctx.JSONRPCError(forwardError(err), request.ID)
 	}
 
 	// Process initialize response if needed
 	if err := processInitResponse(request, response, proxyInfo, sessionID); err != nil {
-		return ctx.JSONRPCError(jsonrpc.ErrorParseError, request.ID)
+		return ctx.JSONRPCError(initializeError(err), request.ID)
 	}
 
 	// Send final response
 	return sendResponse(c, ctx, proxyInfo, request, response)
 }
 
+// streamRequest forwards the request and answers with an event stream, relaying the
+// notifications and server requests of the session as they arrive, then the response
+func streamRequest(ctx *proxy.SSEContext, session *proxy.SSESession, key string, serverConfig *mcpserver.ServerConfig, proxyInfo *proxy.ProxyInfo, request *jsonrpc.Request) error {
+	writer, err := proxy.NewSSEWriter(ctx)
+	if err != nil {
+		return ctx.JSONRPCError(jsonrpc.ErrorInternalError, request.ID)
+	}
+
+	// Events of the stream are kept for replay, so that the client can resume it with Last-Event-ID
+	stream := session.OpenStream(writer)
+	if err := stream.Start(); err != nil {
+		log.Printf("Failed to start stream of session %s: %v", session.ID(), err)
+		return ctx.JSONRPCError(jsonrpc.ErrorInternalError, request.ID)
+	}
+
+	// The stream receives the messages of its request
+	listener := session.ListenRequest(request)
+	defer session.Unlisten(listener)
+
+	done := make(chan *jsonrpc.Response, 1)
+	go func() {
+		// A disconnect is not a cancellation, the client may resume the stream
+		response, err := forwardRequest(ctx, session.Context(), session, key, serverConfig, request)
+		if err != nil {
+			response = jsonrpc.NewErrorResponse(forwardError(err), request.ID)
+		}
+		done <- response
+	}()
+
+	for {
+		select {
+		case message := <-listener.Messages():
+			// Once the connection is gone, the events are kept for a client resuming the stream
+			if err := stream.SendMessage(message); err != nil {
+				log.Printf("Failed to relay message to session %s: %v", session.ID(), err)
+			}
+		case response := <-done:
+			finishRequest(proxyInfo, response)
+			return stream.Complete(response)
+		}
+	}
+}
+
+// processBatch handles JSON-RPC batch requests, forwarding the requests of the batch in parallel
+func processBatch(c echo.Context, ctx *proxy.SSEContext, key string, serverConfig *mcpserver.ServerConfig, requests []*jsonrpc.Request) error {
+	if len(requests) == 0 {
+		return ctx.JSONRPCError(jsonrpc.ErrorInvalidRequest, nil)
+	}
+
+	// Initialize must not be part of a batch
+	for _, request := range requests {
+		if request.Method == MethodInitialize {
+			return ctx.JSONRPCError(jsonrpc.ErrorInvalidRequest, request.ID)
+		}
+	}
+
+	// Batches were removed in protocol version 2025-06-18
+	if session := restoreSession(ctx, key, serverConfig, c.Request().Header.Get(HeaderMcpSessionID)); session != nil && !jsonrpc.SupportsBatch(session.ProxyInfo().ProtocolVersion) {
+		return ctx.JSONRPCError(jsonrpc.ErrorInvalidRequest, nil)
+	}
+
+	var forwards []*jsonrpc.Request
+	var proxyInfos []*proxy.ProxyInfo
+	var sessionID string
+
+	// Elements that are not valid requests are answered on their own
+	var results []*jsonrpc.Response
+
+	for _, request := range requests {
+		if request.Invalid() {
+			results = append(results, jsonrpc.NewErrorResponse(jsonrpc.ErrorInvalidRequest, request.ID))
+			continue
+		}
+
+		// Route client responses to server-initiated requests
+		if request.IsResponse() {
+			respondServerRequest(c, ctx, key, request)
+			continue
+		}
+
+		proxyInfo, id, err := setupSession(c, ctx, key, serverConfig, request)
+		if err != nil || c.Response().Committed {
+			return err
+		}
+
+		sessionID = id
+		forwards = append(forwards, request)
+		proxyInfos = append(proxyInfos, proxyInfo)
+	}
+
+	session := restoreSession(ctx, key, serverConfig, sessionID)
+	responses := make([]*jsonrpc.Response, len(forwards))
+
+	var wg sync.WaitGroup
+	for i, request := range forwards {
+		wg.Add(1)
+		go func(i int, request *jsonrpc.Request) {
+			defer wg.Done()
+
+			response, err := forwardRequest(ctx, c.Request().Context(), session, key, serverConfig, request)
+			if err != nil && request.ID != nil {
+				response = jsonrpc.NewErrorResponse(forwardError(err), request.ID)
+			}
+
+			finishRequest(proxyInfos[i], response)
+			responses[i] = response
+		}(i, request)
+	}
+	wg.Wait()
+
+	// Notifications and responses get no reply
+	for _, response := range responses {
+		if response != nil {
+			results = append(results, response)
+		}
+	}
+
+	if len(results) == 0 {
+		return c.NoContent(http.StatusAccepted)
+	}
+
+	if useEventStream(c) {
+		return ctx.JSONRPCStreamBatchResponse(results)
+	}
+
+	return ctx.JSONRPCBatchResponse(results)
+}
+
+// respondServerRequest delivers the client response to the server-initiated request of its session
+func respondServerRequest(c echo.Context, ctx *proxy.SSEContext, key string, request *jsonrpc.Request) {
+	session := ctx.GetSession(c.Request().Header.Get(HeaderMcpSessionID))
+	if session == nil || session.Key() != key {
+		log.Printf("No session for response: %v", request.ID)
+		return
+	}
+
+	session.Respond(request.Response())
+}
+
 // parseRequest validates the request and parses JSON-RPC
-func parseRequest(c echo.Context, ctx *proxy.SSEContext) (string, *mcpserver.ServerConfig, *jsonrpc.Request, error) {
+func parseRequest(c echo.Context, ctx *proxy.SSEContext) (string, *mcpserver.ServerConfig, []*jsonrpc.Request, bool, error) {
 	// Use common validation function
 	key, serverConfig, err := validateKeyAndConfig(c)
-	if err != nil {
-		return "", nil, nil, err
+	if err != nil || c.Response().Committed {
+		return "", nil, nil, false, err
 	}
 
-	// Parse JSON-RPC request
-	request, err := ctx.GetJSONRPCRequest()
+	// Parse JSON-RPC request or batch
+	requests, batch, err := ctx.GetJSONRPCRequests()
 	if err != nil {
-		return "", nil, nil, ctx.JSONRPCError(jsonrpc.ErrorParseError, nil)
+		return "", nil, nil, false, ctx.JSONRPCError(jsonrpc.ErrorParseError, nil)
 	}
 
-	return key, serverConfig, request, nil
+	return key, serverConfig, requests, batch, nil
 }
 
 // setupSession creates proxy info and manages session
@@ -107,31 +268,33 @@ func setupSession(c echo.Context, ctx *proxy.SSEContext, key string, serverConfi
 	// Add MCP-specific fields
 	header := c.Request().Header
 	proxyInfo.SessionID = header.Get(HeaderMcpSessionID)
-	proxyInfo.RequestID = header.Get(HeaderXRequestID)
+	proxyInfo.RequestID = request.ID
 	proxyInfo.RequestFrom = header.Get(HeaderXRequestFrom)
+	proxyInfo.HeaderRequestID = header.Get(HeaderXRequestID)
 	proxyInfo.JSONRPCVersion = request.JSONRPC
 	proxyInfo.RequestMethod = request.Method
 	proxyInfo.RequestTime = time.Now()
 	proxyInfo.RequestParams = request.Params
 
-	if request.ID != nil {
-		proxyInfo.RequestID = request.ID
-	}
-
 	var sessionID string
 	var err error
 
 	if request.Method == MethodInitialize {
-		sessionID, err = createSession(c, ctx, proxyInfo, request)
+		sessionID, err = createSession(c, ctx, serverConfig, proxyInfo, request)
 	} else {
-		sessionID, err = loadSession(c, proxyInfo)
+		sessionID, err = loadSession(c, ctx, proxyInfo)
 	}
 
 	return proxyInfo, sessionID, err
 }
 
 // createSession creates a new session for initialize requests
-func createSession(c echo.Context, ctx *proxy.SSEContext, proxyInfo *proxy.ProxyInfo, request *jsonrpc.Request) (string, error) {
+func createSession(c echo.Context, ctx *proxy.SSEContext, serverConfig *mcpserver.ServerConfig, proxyInfo *proxy.ProxyInfo, request *jsonrpc.Request) (string, error) {
+	// No new session is accepted while shutting down
+	if ctx.Draining() {
+		return "", c.String(http.StatusServiceUnavailable, ErrShuttingDown)
+	}
+
 	// Parse initialize parameters
 	paramsBytes, err := json.Marshal(request.Params)
 	if err != nil {
@@ -143,19 +306,29 @@ func createSession(c echo.Context, ctx *proxy.SSEContext, proxyInfo *proxy.Proxy
 		return "", ctx.JSONRPCError(jsonrpc.ErrorParseError, nil)
 	}
 
-	// Generate session ID using common function
-	sessionID := proxyInfo.GetSessionID()
+	// Generate a unique session ID for this client
+	sessionID := util.GenSessionID()
 	proxyInfo.ConnectionTime = time.Now()
 	proxyInfo.ClientName = params.ClientInfo.Name
 	proxyInfo.ClientVersion = params.ClientInfo.Version
-	proxyInfo.ProtocolVersion = params.ProtocolVersion
 	proxyInfo.SessionID = sessionID
 
+	// Negotiate the protocol version with the client
+	if err := negotiateInitialize(proxyInfo, request, &params); err != nil {
+		return "", ctx.JSONRPCError(initializeError(err), request.ID)
+	}
+
 	// Store proxy info
 	if err := proxy.StoreProxyInfo(sessionID, proxyInfo); err != nil {
 		log.Printf("Failed to store proxy info: %v", err)
 	}
 
+	// Store session for server-initiated messages, delivered over the GET stream
+	ctx.StoreSession(sessionID, proxy.NewSSESession(nil, serverConfig, proxyInfo))
+	if err := proxy.StoreSessionNode(sessionID); err != nil {
+		log.Printf("Failed to store node of session: %v", err)
+	}
+
 	// Set session ID in response header
 	c.Response().Header().Set(HeaderMcpSessionID, sessionID)
 
@@ -164,58 +337,125 @@ func createSession(c echo.Context, ctx *proxy.SSEContext, proxyInfo *proxy.Proxy
 }
 
 // loadSession validates and retrieves existing session data
-func loadSession(c echo.Context, proxyInfo *proxy.ProxyInfo) (string, error) {
+func loadSession(c echo.Context, ctx *proxy.SSEContext, proxyInfo *proxy.ProxyInfo) (string, error) {
 	sessionID := proxyInfo.SessionID
 	if sessionID == "" {
 		return "", c.String(http.StatusBadRequest, ErrInvalidSessionID)
 	}
 
+	// Session IDs are bound to the server key they were created for
+	session := ctx.GetSession(sessionID)
+	if session != nil && session.Key() != proxyInfo.ServerKey {
+		return "", c.String(http.StatusNotFound, ErrSessionNotFound)
+	}
+
 	// Try to get existing proxy info and merge relevant data
 	if existingInfo, err := proxy.GetProxyInfo(sessionID); err == nil && existingInfo != nil && existingInfo.SessionID == sessionID {
 		proxyInfo.ClientName = existingInfo.ClientName
 		proxyInfo.ClientVersion = existingInfo.ClientVersion
 		proxyInfo.ProtocolVersion = existingInfo.ProtocolVersion
+		proxyInfo.ServerProtocolVersion = existingInfo.ServerProtocolVersion
 		proxyInfo.ConnectionTime = existingInfo.ConnectionTime
 		proxyInfo.ServerName = existingInfo.ServerName
 		proxyInfo.ServerVersion = existingInfo.ServerVersion
 	}
 
+	// Requests carry the protocol version negotiated on initialize
+	negotiated := proxyInfo.ProtocolVersion
+	if session != nil {
+		negotiated = session.ProxyInfo().ProtocolVersion
+	}
+	if !validProtocolVersion(c, negotiated) {
+		return "", c.String(http.StatusBadRequest, ErrUnsupportedProtocolVersion)
+	}
+
 	log.Printf("Using existing session: %s", sessionID)
 	return sessionID, nil
 }
 
-// forwardRequest handles MCP client operations and request forwarding
-func forwardRequest(ctx *proxy.SSEContext, key string, serverConfig *mcpserver.ServerConfig, request *jsonrpc.Request) (*jsonrpc.Response, error) {
-	// Get existing client or create new one
-	client := ctx.GetClient(key)
-	if client == nil {
-		newClient, err := mcpclient.NewClient(serverConfig)
+// forwardRequest handles MCP client operations and request forwarding,
+// the request is cancelled with parent, with the session or when the client cancels it
+func forwardRequest(ctx *proxy.SSEContext, parent context.Context, session *proxy.SSESession, key string, serverConfig *mcpserver.ServerConfig, request *jsonrpc.Request) (*jsonrpc.Response, error) {
+	// Client cancellations apply to the in-flight request, not to the backend
+	if request.Method == jsonrpc.MethodCancelledNotification {
+		cancelRequest(session, request)
+		return nil, nil
+	}
+
+	reqCtx := parent
+	if session != nil {
+		var release func()
+		var err error
+		reqCtx, release, err = session.RequestContext(reqCtx, request.ID)
 		if err != nil {
-			log.Printf("Failed to connect to MCP server: %v", err)
-			return nil, ctx.JSONRPCError(jsonrpc.ErrorProxyError, request.ID)
+			return nil, err
 		}
+		defer release()
+	}
 
-		if err := newClient.Error(); err != nil {
-			log.Printf("MCP server run failed: %v", err)
-			return nil, ctx.JSONRPCError(jsonrpc.ErrorProxyError, request.ID)
+	// Sessions of servers not sharing process own a dedicated client
+	if !serverConfig.ShareProcess {
+		response, err := forwardSessionRequest(ctx, reqCtx, session, request)
+		if err != nil {
+			return nil, err
 		}
 
-		// Set up notification handler
-		newClient.OnNotification(func(message []byte) {
-			log.Printf("Received notification: %s", message)
-		})
+		convertResponse(session, request, response)
+		return response, nil
+	}
 
-		ctx.StoreClient(key, newClient)
-		client = newClient
+	// Get existing client or create new one
+	client, err := sharedClient(ctx, key, serverConfig)
+	if err != nil {
+		return nil, err
 	}
 
 	// Forward message to MCP server
-	response, err := client.ForwardMessage(request)
+	if session != nil {
+		client = mcpclient.BindSession(client, session.ID())
+		session.BeginRequest()
+		defer session.EndRequest()
+	}
+
+	trackSubscription(session, request, nil)
+	response, err := client.ForwardMessage(reqCtx, request)
 	if err != nil {
 		log.Printf("Failed to forward message: %v", err)
+		if requestAborted(err) {
+			return nil, err
+		}
 		client.Close()
 		ctx.DeleteClient(key)
-		return nil, ctx.JSONRPCError(jsonrpc.ErrorProxyError, request.ID)
+		return nil, err
+	}
+
+	convertResponse(session, request, response)
+	trackSubscription(session, request, response)
+
+	return response, nil
+}
+
+// forwardSessionRequest forwards the request to the dedicated client of the session
+func forwardSessionRequest(ctx *proxy.SSEContext, reqCtx context.Context, session *proxy.SSESession, request *jsonrpc.Request) (*jsonrpc.Response, error) {
+	if session == nil {
+		log.Printf("No session found for dedicated client")
+		return nil, errors.New("session not found")
+	}
+
+	client, err := getSessionClient(ctx, session, request)
+	if err != nil {
+		log.Printf("Failed to get session client: %v", err)
+		return nil, err
+	}
+
+	response, err := client.ForwardMessage(reqCtx, request)
+	if err != nil {
+		log.Printf("Failed to forward message: %v", err)
+		if requestAborted(err) {
+			return nil, err
+		}
+		session.CloseClient()
+		return nil, err
 	}
 
 	return response, nil
@@ -243,6 +483,11 @@ func processInitResponse(request *jsonrpc.Request, response *jsonrpc.Response, p
 	proxyInfo.ServerName = result.ServerInfo.Name
 	proxyInfo.ServerVersion = result.ServerInfo.Version
 
+	if err := negotiateInitializeResult(proxyInfo, response, &result); err != nil {
+		log.Printf("Failed to negotiate protocol version: %v", err)
+		return err
+	}
+
 	// Store updated proxy info
 	if err := proxy.StoreProxyInfo(sessionID, proxyInfo); err != nil {
 		log.Printf("Failed to store proxy info with server info: %v", err)
@@ -254,6 +499,19 @@ func processInitResponse(request *jsonrpc.Request, response *jsonrpc.Response, p
 
 // sendResponse finalizes processing and sends the response
 func sendResponse(c echo.Context, ctx *proxy.SSEContext, proxyInfo *proxy.ProxyInfo, request *jsonrpc.Request, response *jsonrpc.Response) error {
+	finishRequest(proxyInfo, response)
+
+	// Handle notification response
+	if response == nil {
+		return ctx.JSONRPCAcceptResponse(response)
+	}
+
+	// Determine response format and send
+	return writeResponse(c, ctx, response)
+}
+
+// finishRequest records the response in proxy info and saves the logs
+func finishRequest(proxyInfo *proxy.ProxyInfo, response *jsonrpc.Response) {
 	// Update response timing and proxy info
 	proxyInfo.ResponseResult = response
 	proxyInfo.ResponseTime = time.Now()
@@ -275,18 +533,25 @@ func sendResponse(c echo.Context, ctx *proxy.SSEContext, proxyInfo *proxy.ProxyI
 	if proxyInfoBytes, err := json.Marshal(proxyInfo); err == nil {
 		log.Printf("Proxy info: %s", string(proxyInfoBytes))
 	}
+}
 
-	// Handle notification response
-	if response == nil {
-		return ctx.JSONRPCAcceptResponse(response)
+// writeResponse determines and sends the appropriate response format
+func writeResponse(c echo.Context, ctx *proxy.SSEContext, response *jsonrpc.Response) error {
+	if useEventStream(c) {
+		// Send streaming SSE response with fallback
+		if err := ctx.JSONRPCStreamResponse(response); err != nil {
+			log.Printf("Failed to send SSE response: %v", err)
+			return ctx.JSONRPCResponse(response)
+		}
+		return nil
 	}
 
-	// Determine response format and send
-	return writeResponse(c, ctx, response)
+	// Send regular JSON response
+	return ctx.JSONRPCResponse(response)
 }
 
-// writeResponse determines and sends the appropriate response format
-func writeResponse(c echo.Context, ctx *proxy.SSEContext, response *jsonrpc.Response) error {
+// useEventStream reports whether the client prefers an event-stream response
+func useEventStream(c echo.Context) bool {
 	accept := c.Request().Header.Get("Accept")
 	acceptValues := strings.Split(accept, ",")
 
@@ -303,17 +568,7 @@ func writeResponse(c echo.Context, ctx *proxy.SSEContext, response *jsonrpc.Resp
 		}
 	}
 
-	if useEventStream {
-		// Send streaming SSE response with fallback
-		if err := ctx.JSONRPCStreamResponse(response); err != nil {
-			log.Printf("Failed to send SSE response: %v", err)
-			return ctx.JSONRPCResponse(response)
-		}
-		return nil
-	}
-
-	// Send regular JSON response
-	return ctx.JSONRPCResponse(response)
+	return useEventStream
 }
 
 // handleSSE handles GET requests for establishing persistent SSE connections
@@ -327,22 +582,103 @@ func handleSSE(c echo.Context, ctx *proxy.SSEContext) error {
 	}
 
 	// Validate server configuration
-	if mcpserver.GetServerConfig(key) == nil {
+	serverConfig := mcpserver.GetServerConfig(key)
+	if serverConfig == nil {
 		return c.String(http.StatusBadRequest, ErrInvalidServerConfig)
 	}
 
+	// Server-initiated messages are bound to the session
+	sessionID := c.Request().Header.Get(HeaderMcpSessionID)
+	if sessionID == "" {
+		return c.String(http.StatusBadRequest, ErrInvalidSessionID)
+	}
+
+	session := restoreSession(ctx, key, serverConfig, sessionID)
+	if session == nil {
+		return c.String(http.StatusNotFound, ErrSessionNotFound)
+	}
+
+	if !validProtocolVersion(c, session.ProxyInfo().ProtocolVersion) {
+		return c.String(http.StatusBadRequest, ErrUnsupportedProtocolVersion)
+	}
+
 	// Start SSE stream
 	writer, err := ctx.JSONRPCStreamStart()
 	if err != nil {
 		return c.String(http.StatusInternalServerError, "Failed to start SSE stream")
 	}
 
-	// Maintain connection
+	// Replay the events the client missed on the stream it resumes
+	if lastEventID := c.Request().Header.Get(HeaderLastEventID); lastEventID != "" {
+		standalone, err := session.ResumeStream(c.Request().Context(), writer, lastEventID)
+		switch {
+		case errors.Is(err, proxy.ErrEventNotFound):
+			log.Printf("Event %s of session %s not found, starting a new stream", lastEventID, sessionID)
+		case errors.Is(err, proxy.ErrEventsLost):
+			log.Printf("Events after %s of session %s are no longer buffered, starting a new stream", lastEventID, sessionID)
+		case err != nil:
+			log.Printf("Failed to resume stream of session %s: %v", sessionID, err)
+			return nil
+		case !standalone:
+			// The resumed request stream is complete
+			return nil
+		}
+	}
+
+	// Relay session messages until the client goes away or the session is closed
+	stream := session.StandaloneStream(writer)
+	listener := session.ListenStandalone()
+	defer session.Unlisten(listener)
 	writer.SendEventData("connection", "ready")
-	<-c.Request().Context().Done()
-	writer.SendEventData("connection", "closed")
 
-	return nil
+	heartbeat := time.NewTicker(heartbeatInterval())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-heartbeat.C:
+			if err := writer.SendHeartbeat(); err != nil {
+				log.Printf("Failed to send heartbeat to session %s: %v", sessionID, err)
+				return nil
+			}
+		case message := <-listener.Messages():
+			if err := stream.SendMessage(message); err != nil {
+				log.Printf("Failed to send message to session %s: %v", sessionID, err)
+				return nil
+			}
+		case <-listener.Closed():
+			// Another GET stream took over
+			return nil
+		case <-session.Done():
+			writer.SendEventData("connection", "closed")
+			return nil
+		case <-c.Request().Context().Done():
+			return nil
+		}
+	}
+}
+
+// restoreSession returns the live session, or rebuilds it from the cached proxy info
+func restoreSession(ctx *proxy.SSEContext, key string, serverConfig *mcpserver.ServerConfig, sessionID string) *proxy.SSESession {
+	if session := ctx.GetSession(sessionID); session != nil {
+		if session.Key() != key {
+			return nil
+		}
+		return session
+	}
+
+	proxyInfo, err := proxy.GetProxyInfo(sessionID)
+	if err != nil || proxyInfo.SessionID != sessionID || proxyInfo.ServerKey != key {
+		return nil
+	}
+
+	session := proxy.NewSSESession(nil, serverConfig, proxyInfo)
+	ctx.StoreSession(sessionID, session)
+	if err := proxy.StoreSessionNode(sessionID); err != nil {
+		log.Printf("Failed to store node of session %s: %v", sessionID, err)
+	}
+
+	return session
 }
 
 // cleanupSession handles DELETE requests for session cleanup
@@ -352,17 +688,17 @@ func cleanupSession(c echo.Context, ctx *proxy.SSEContext) error {
 	// Get session ID for cleanup
 	sessionID := c.Request().Header.Get(HeaderMcpSessionID)
 	if sessionID == "" {
-		sessionID = util.MD5(key)
+		return c.String(http.StatusBadRequest, ErrInvalidSessionID)
 	}
 
-	// Clean up resources
-	ctx.DeleteClient(key)
-	ctx.DeleteSession(sessionID)
-
-	if err := proxy.DeleteProxyInfo(sessionID); err != nil {
-		log.Printf("Failed to delete proxy info for session %s: %v", sessionID, err)
+	session := ctx.GetSession(sessionID)
+	if session != nil && session.Key() != key {
+		return c.String(http.StatusNotFound, ErrSessionNotFound)
 	}
 
+	// Clean up resources
+	ctx.CloseSession(sessionID)
+
 	return c.JSON(http.StatusOK, map[string]string{
 		"message":   "Session cleaned up successfully",
 		"sessionId": sessionID,
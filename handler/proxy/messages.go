@@ -1,8 +1,11 @@
 package proxy
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/chatmcp/mcprouter/service/jsonrpc"
@@ -14,54 +17,142 @@ import (
 // Messages is a handler for the messages endpoint
 func Messages(c echo.Context) error {
 	// Validate context and parse request
-	ctx, session, request, err := parseMessageRequest(c)
-	if err != nil {
+	ctx, session, requests, batch, err := parseMessageRequest(c)
+	if err != nil || c.Response().Committed {
 		return err
 	}
 
+	if batch {
+		return processMessageBatch(ctx, session, requests)
+	}
+
+	request := requests[0]
+
+	// Route client responses to server-initiated requests
+	if request.IsResponse() {
+		session.Respond(request.Response())
+		return ctx.JSONRPCAcceptResponse(nil)
+	}
+
 	// Setup message session and proxy info
 	proxyInfo, sseKey, err := setupMessageSession(ctx, session, request)
-	if err != nil {
+	if err != nil || ctx.Response().Committed {
 		return err
 	}
 
 	// Process message with MCP client
 	response, err := processMessageWithClient(ctx, session, sseKey, request)
 	if err != nil {
-		return err
+		return ctx.JSONRPCError(forwardError(err), request.ID)
 	}
 
 	// Handle message response and finalize
 	return handleMessageResponse(ctx, session, request, response, proxyInfo)
 }
 
+// processMessageBatch handles JSON-RPC batch messages, forwarding the requests of the batch in parallel
+func processMessageBatch(ctx *proxy.SSEContext, session *proxy.SSESession, requests []*jsonrpc.Request) error {
+	// Batches were removed in protocol version 2025-06-18
+	if len(requests) == 0 || !jsonrpc.SupportsBatch(session.ProxyInfo().ProtocolVersion) {
+		return ctx.JSONRPCError(jsonrpc.ErrorInvalidRequest, nil)
+	}
+
+	responses := make([]*jsonrpc.Response, len(requests))
+
+	var wg sync.WaitGroup
+	for i, request := range requests {
+		if request.Invalid() {
+			responses[i] = jsonrpc.NewErrorResponse(jsonrpc.ErrorInvalidRequest, request.ID)
+			continue
+		}
+
+		// Route client responses to server-initiated requests
+		if request.IsResponse() {
+			session.Respond(request.Response())
+			continue
+		}
+
+		// Initialize must not be part of a batch
+		if request.Method == MethodInitialize {
+			responses[i] = jsonrpc.NewErrorResponse(jsonrpc.ErrorInvalidRequest, request.ID)
+			continue
+		}
+
+		// Each request of the batch is logged with its own copy of the session proxy info
+		proxyInfo := *session.ProxyInfo()
+		proxyInfo.JSONRPCVersion = request.JSONRPC
+		proxyInfo.RequestMethod = request.Method
+		proxyInfo.RequestTime = time.Now()
+		proxyInfo.RequestParams = request.Params
+		proxyInfo.RequestID = request.ID
+
+		wg.Add(1)
+		go func(i int, request *jsonrpc.Request, proxyInfo *proxy.ProxyInfo) {
+			defer wg.Done()
+
+			response, err := processMessageWithClient(ctx, session, session.Key(), request)
+			if err != nil && request.ID != nil {
+				response = jsonrpc.NewErrorResponse(forwardError(err), request.ID)
+			}
+
+			finishMessage(proxyInfo, response)
+			responses[i] = response
+		}(i, request, &proxyInfo)
+	}
+	wg.Wait()
+
+	// Notifications and responses get no reply
+	results := make([]*jsonrpc.Response, 0, len(responses))
+	for _, response := range responses {
+		if response != nil {
+			results = append(results, response)
+		}
+	}
+
+	if len(results) == 0 {
+		return ctx.NoContent(http.StatusAccepted)
+	}
+
+	// Send the batch response over SSE as one message
+	if b, err := json.Marshal(results); err == nil {
+		session.SendMessage(string(b))
+	}
+
+	return ctx.JSONRPCBatchResponse(results)
+}
+
 // parseMessageRequest validates context and parses message request
-func parseMessageRequest(c echo.Context) (*proxy.SSEContext, *proxy.SSESession, *jsonrpc.Request, error) {
+func parseMessageRequest(c echo.Context) (*proxy.SSEContext, *proxy.SSESession, []*jsonrpc.Request, bool, error) {
 	// Validate SSE context using common function
 	ctx, err := validateSSEContext(c)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, false, err
 	}
 
 	// Validate session ID parameter
 	sessionID := ctx.QueryParam("sessionid")
 	if sessionID == "" {
-		return nil, nil, nil, ctx.JSONRPCError(jsonrpc.ErrorInvalidParams, nil)
+		return nil, nil, nil, false, ctx.JSONRPCError(jsonrpc.ErrorInvalidParams, nil)
+	}
+
+	// Sessions held by another replica are handled there
+	if routed, err := routeToOwner(c, ctx, sessionID); routed {
+		return nil, nil, nil, false, err
 	}
 
 	// Get session from context
 	session := ctx.GetSession(sessionID)
 	if session == nil {
-		return nil, nil, nil, ctx.JSONRPCError(jsonrpc.ErrorInvalidParams, nil)
+		return nil, nil, nil, false, ctx.JSONRPCError(jsonrpc.ErrorInvalidParams, nil)
 	}
 
-	// Parse JSON-RPC request
-	request, err := ctx.GetJSONRPCRequest()
+	// Parse JSON-RPC request or batch
+	requests, batch, err := ctx.GetJSONRPCRequests()
 	if err != nil {
-		return nil, nil, nil, ctx.JSONRPCError(jsonrpc.ErrorParseError, nil)
+		return nil, nil, nil, false, ctx.JSONRPCError(jsonrpc.ErrorParseError, nil)
 	}
 
-	return ctx, session, request, nil
+	return ctx, session, requests, batch, nil
 }
 
 // setupMessageSession configures session and proxy info for message processing
@@ -74,10 +165,7 @@ func setupMessageSession(ctx *proxy.SSEContext, session *proxy.SSESession, reque
 	proxyInfo.RequestMethod = request.Method
 	proxyInfo.RequestTime = time.Now()
 	proxyInfo.RequestParams = request.Params
-
-	if request.ID != nil {
-		proxyInfo.RequestID = request.ID
-	}
+	proxyInfo.RequestID = request.ID
 
 	// Handle initialize method specially
 	if request.Method == "initialize" {
@@ -91,72 +179,108 @@ func setupMessageSession(ctx *proxy.SSEContext, session *proxy.SSESession, reque
 
 // processInitializeParams handles initialize method parameters
 func processInitializeParams(ctx *proxy.SSEContext, session *proxy.SSESession, proxyInfo *proxy.ProxyInfo, request *jsonrpc.Request) error {
+	if err := applyInitializeParams(session, proxyInfo, request); err != nil {
+		return ctx.JSONRPCError(initializeError(err), request.ID)
+	}
+
+	// Store updated session
+	ctx.StoreSession(session.ProxyInfo().SessionID, session)
+
+	return nil
+}
+
+// applyInitializeParams records the client information of the initialize request in the session
+func applyInitializeParams(session *proxy.SSESession, proxyInfo *proxy.ProxyInfo, request *jsonrpc.Request) error {
 	// Parse initialize parameters
 	paramsBytes, _ := json.Marshal(request.Params)
 	params := &jsonrpc.InitializeParams{}
 	if err := json.Unmarshal(paramsBytes, params); err != nil {
-		return ctx.JSONRPCError(jsonrpc.ErrorParseError, nil)
+		return err
 	}
 
 	// Update proxy info with client information
 	proxyInfo.ClientName = params.ClientInfo.Name
 	proxyInfo.ClientVersion = params.ClientInfo.Version
-	proxyInfo.ProtocolVersion = params.ProtocolVersion
 
-	// Store updated session
+	// Negotiate the protocol version with the client
+	if err := negotiateInitialize(proxyInfo, request, params); err != nil {
+		return err
+	}
+
 	session.SetProxyInfo(proxyInfo)
-	ctx.StoreSession(session.ProxyInfo().SessionID, session)
 
 	return nil
 }
 
 // processMessageWithClient handles MCP client operations and message forwarding
 func processMessageWithClient(ctx *proxy.SSEContext, session *proxy.SSESession, sseKey string, request *jsonrpc.Request) (*jsonrpc.Response, error) {
+	// Client cancellations apply to the in-flight request, not to the backend
+	if request.Method == jsonrpc.MethodCancelledNotification {
+		cancelRequest(session, request)
+		return nil, nil
+	}
+
+	// Requests live as long as the session, the response is delivered over its stream
+	reqCtx, release, err := session.RequestContext(session.Context(), request.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Sessions of servers not sharing process own a dedicated client
+	if !session.ShareProcess() {
+		return processMessageWithSessionClient(ctx, reqCtx, session, request)
+	}
+
 	// Get or create MCP client
-	client := ctx.GetClient(sseKey)
-	if client == nil {
-		newClient, err := createMCPClient(ctx, session, sseKey)
-		if err != nil {
-			return nil, ctx.JSONRPCError(jsonrpc.ErrorProxyError, request.ID)
-		}
-		client = newClient
+	client, err := sharedClient(ctx, sseKey, session.ServerConfig())
+	if err != nil {
+		return nil, err
 	}
 
 	// Forward message to MCP server
-	response, err := client.ForwardMessage(request)
+	session.BeginRequest()
+	defer session.EndRequest()
+
+	trackSubscription(session, request, nil)
+	response, err := mcpclient.BindSession(client, session.ID()).ForwardMessage(reqCtx, request)
 	if err != nil {
 		fmt.Printf("Forward message failed: %v\n", err)
+		if requestAborted(err) {
+			return nil, err
+		}
 		session.Close()
 		ctx.DeleteClient(sseKey)
-		return nil, ctx.JSONRPCError(jsonrpc.ErrorProxyError, request.ID)
+		return nil, err
 	}
 
+	convertResponse(session, request, response)
+	trackSubscription(session, request, response)
+
 	return response, nil
 }
 
-// createMCPClient creates and configures a new MCP client
-func createMCPClient(ctx *proxy.SSEContext, session *proxy.SSESession, sseKey string) (mcpclient.Client, error) {
-	client, err := mcpclient.NewClient(session.ServerConfig())
+// processMessageWithSessionClient forwards the message to the dedicated client of the session
+func processMessageWithSessionClient(ctx *proxy.SSEContext, reqCtx context.Context, session *proxy.SSESession, request *jsonrpc.Request) (*jsonrpc.Response, error) {
+	client, err := getSessionClient(ctx, session, request)
 	if err != nil {
-		fmt.Printf("Connect to MCP server failed: %v\n", err)
+		fmt.Printf("Get session client failed: %v\n", err)
 		return nil, err
 	}
 
-	if err := client.Error(); err != nil {
-		fmt.Printf("MCP server run failed: %v\n", err)
+	response, err := client.ForwardMessage(reqCtx, request)
+	if err != nil {
+		fmt.Printf("Forward message failed: %v\n", err)
+		if requestAborted(err) {
+			return nil, err
+		}
+		session.CloseClient()
 		return nil, err
 	}
 
-	// Set up notification handler
-	client.OnNotification(func(message []byte) {
-		fmt.Printf("Received notification: %s\n", message)
-		session.SendMessage(string(message))
-	})
-
-	// Store client in context
-	ctx.StoreClient(sseKey, client)
+	convertResponse(session, request, response)
 
-	return client, nil
+	return response, nil
 }
 
 // handleMessageResponse processes response and finalizes message handling
@@ -165,7 +289,7 @@ func handleMessageResponse(ctx *proxy.SSEContext, session *proxy.SSESession, req
 		// Handle initialize response specially
 		if request.Method == "initialize" && response.Result != nil {
 			if err := processInitializeResponse(session, proxyInfo, response); err != nil {
-				return ctx.JSONRPCError(jsonrpc.ErrorParseError, request.ID)
+				return ctx.JSONRPCError(initializeError(err), request.ID)
 			}
 		}
 
@@ -173,6 +297,13 @@ func handleMessageResponse(ctx *proxy.SSEContext, session *proxy.SSESession, req
 		session.SendMessage(response.String())
 	}
 
+	finishMessage(proxyInfo, response)
+
+	return ctx.JSONRPCResponse(response)
+}
+
+// finishMessage records the response in proxy info and logs it
+func finishMessage(proxyInfo *proxy.ProxyInfo, response *jsonrpc.Response) {
 	// Update response timing and proxy info
 	proxyInfo.ResponseResult = response
 	proxyInfo.ResponseTime = time.Now()
@@ -185,8 +316,6 @@ func handleMessageResponse(ctx *proxy.SSEContext, session *proxy.SSESession, req
 	if proxyInfoBytes, err := json.Marshal(proxyInfo); err == nil {
 		fmt.Printf("Proxy info: %s\n", string(proxyInfoBytes))
 	}
-
-	return ctx.JSONRPCResponse(response)
 }
 
 // processInitializeResponse handles initialize method response
@@ -203,6 +332,11 @@ func processInitializeResponse(session *proxy.SSESession, proxyInfo *proxy.Proxy
 	proxyInfo.ServerName = result.ServerInfo.Name
 	proxyInfo.ServerVersion = result.ServerInfo.Version
 
+	if err := negotiateInitializeResult(proxyInfo, response, result); err != nil {
+		fmt.Printf("Negotiate protocol version failed: %v\n", err)
+		return err
+	}
+
 	// Store updated session
 	session.SetProxyInfo(proxyInfo)
 
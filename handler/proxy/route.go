@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/chatmcp/mcprouter/service/proxy"
+	"github.com/labstack/echo/v4"
+)
+
+// routeToOwner hands the request of a session this replica does not hold over to the replica owning it,
+// it reports false when the request is to be handled here: no owner is known, or the owner is gone
+func routeToOwner(c echo.Context, ctx *proxy.SSEContext, sessionID string) (bool, error) {
+	req := c.Request()
+
+	// Requests are handed over once, a replica never routes what it was routed
+	if sessionID == "" || ctx.GetSession(sessionID) != nil || req.Header.Get(HeaderXForwardedBy) != "" {
+		return false, nil
+	}
+
+	nodeURL := proxy.GetSessionNode(sessionID)
+	if nodeURL == "" || nodeURL == proxy.NodeURL() {
+		return false, nil
+	}
+
+	target, err := url.Parse(nodeURL)
+	if err != nil {
+		log.Printf("Invalid node %s of session %s: %v", nodeURL, sessionID, err)
+		return false, nil
+	}
+
+	// The body is kept to handle the request here when the owner cannot be reached
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return true, c.String(http.StatusBadRequest, err.Error())
+	}
+
+	failed := false
+	rp := httputil.NewSingleHostReverseProxy(target)
+	rp.FlushInterval = -1 // event streams are relayed as they are written
+	rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Printf("Failed to route session %s to %s: %v", sessionID, nodeURL, err)
+		failed = true
+	}
+
+	routed := req.Clone(req.Context())
+	routed.Body = io.NopCloser(bytes.NewReader(body))
+	routed.Header.Set(HeaderXForwardedBy, proxy.NodeURL())
+
+	log.Printf("Routing session %s to %s", sessionID, nodeURL)
+	rp.ServeHTTP(c.Response(), routed)
+
+	if failed && !c.Response().Committed {
+		// The owner is gone, the session is taken over when it can be restored here
+		if err := proxy.DeleteSessionNode(sessionID); err != nil {
+			log.Printf("Failed to delete node of session %s: %v", sessionID, err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		return false, nil
+	}
+
+	return true, nil
+}
@@ -3,9 +3,11 @@ package proxy
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/chatmcp/mcprouter/service/mcpserver"
 	"github.com/chatmcp/mcprouter/service/proxy"
+	"github.com/chatmcp/mcprouter/util"
 	"github.com/labstack/echo/v4"
 )
 
@@ -16,6 +18,11 @@ func SSE(c echo.Context) error {
 		return err
 	}
 
+	// No new session is accepted while shutting down
+	if ctx.Draining() {
+		return c.String(http.StatusServiceUnavailable, ErrShuttingDown)
+	}
+
 	// Parse and validate request
 	key, serverConfig, err := parseSSERequest(c)
 	if err != nil {
@@ -50,13 +57,16 @@ func setupSSEConnection(c echo.Context, ctx *proxy.SSEContext, key string, serve
 	// Create base proxy info using common function
 	proxyInfo := createProxyInfo(key, serverConfig)
 
-	// Generate session ID using common function and set it
-	sessionID := proxyInfo.GetSessionID()
+	// Generate a unique session ID for this connection
+	sessionID := util.GenSessionID()
 	proxyInfo.SessionID = sessionID
 
 	// Create and store session
 	session := proxy.NewSSESession(writer, serverConfig, proxyInfo)
 	ctx.StoreSession(sessionID, session)
+	if err := proxy.StoreSessionNode(sessionID); err != nil {
+		fmt.Printf("failed to store node of session %s: %v\n", sessionID, err)
+	}
 
 	return writer, session, sessionID, nil
 }
@@ -72,10 +82,23 @@ func handleSSEMessages(c echo.Context, writer *proxy.SSEWriter, session *proxy.S
 	messagesUrl := fmt.Sprintf("/messages?sessionid=%s", sessionID)
 	writer.SendEventData("endpoint", messagesUrl)
 
+	// The connection is the stream of all the messages of the session
+	listener := session.ListenStandalone()
+	defer session.Unlisten(listener)
+
+	heartbeat := time.NewTicker(heartbeatInterval())
+	defer heartbeat.Stop()
+
 	// Main message handling loop
 	for {
 		select {
-		case message := <-session.Messages():
+		case <-heartbeat.C:
+			if err := writer.SendHeartbeat(); err != nil {
+				fmt.Printf("SSE failed to send heartbeat to session %s: %v\n", sessionID, err)
+				session.Close()
+				return nil
+			}
+		case message := <-listener.Messages():
 			if err := writer.SendMessage(message); err != nil {
 				fmt.Printf("SSE failed to send message to session %s: %v\n", sessionID, err)
 				session.Close()
@@ -83,6 +106,7 @@ func handleSSEMessages(c echo.Context, writer *proxy.SSEWriter, session *proxy.S
 			}
 		case <-session.Done():
 			fmt.Printf("Session %s closed\n", sessionID)
+			writer.SendEventData("connection", "closed")
 			return nil
 		case <-req.Context().Done():
 			fmt.Println("SSE request done")
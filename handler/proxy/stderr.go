@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chatmcp/mcprouter/service/mcpclient"
+	"github.com/chatmcp/mcprouter/service/proxy"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+)
+
+// Stderr is a handler for operators to fetch the recent stderr of the backend processes of a server key,
+// those of the shared client of the key, or those of the dedicated client of the session given in the query
+func Stderr(c echo.Context) error {
+	// Operators authenticate with the beta api key
+	apikey := strings.TrimSpace(strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer"))
+	if apikey == "" || apikey != viper.GetString("app.beta_api_key") {
+		return c.String(http.StatusUnauthorized, "Invalid authorization key")
+	}
+
+	key, serverConfig, err := validateKeyAndConfig(c)
+	if err != nil || c.Response().Committed {
+		return err
+	}
+
+	if serverConfig.Command == "" && !serverConfig.Composite() {
+		return c.String(http.StatusBadRequest, "Server is not a stdio server")
+	}
+
+	ctx := proxy.GetSSEContext(c)
+
+	var client mcpclient.Client
+	if sessionID := c.QueryParam("session"); sessionID != "" {
+		session := ctx.GetSession(sessionID)
+		if session == nil || session.Key() != key {
+			return c.String(http.StatusNotFound, "Session not found")
+		}
+		client = session.Client()
+	} else {
+		client = ctx.PeekClient(key)
+	}
+
+	stderr := []string{}
+	if client != nil {
+		lines, _ := strconv.Atoi(c.QueryParam("lines"))
+		stderr = append(stderr, mcpclient.Stderr(client, lines)...)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"key":    key,
+		"stderr": stderr,
+	})
+}
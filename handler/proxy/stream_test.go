@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chatmcp/mcprouter/service/mcpclient"
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+	"github.com/chatmcp/mcprouter/service/proxy"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+)
+
+// notifyingClient is a shared client whose backend notifications are sent by the test
+type notifyingClient struct {
+	mcpclient.Client
+	notify mcpclient.NotificationHandler
+}
+
+func (c *notifyingClient) OnNotification(handler mcpclient.NotificationHandler) { c.notify = handler }
+func (c *notifyingClient) OnRequest(mcpclient.RequestHandler)                   {}
+
+func TestGETStreamDelivery(t *testing.T) {
+	viper.Set("mcp_servers.stream.command", "true")
+
+	tests := []struct {
+		name      string
+		sessionID string // session the backend ties the notification to
+		message   string
+		want      bool
+	}{
+		{"notification of the session", "s1", `{"jsonrpc":"2.0","method":"notifications/message","params":{"data":"own"}}`, true},
+		{"list change of the server", "", `{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}`, true},
+		{"notification of another session", "s2", `{"jsonrpc":"2.0","method":"notifications/message","params":{"data":"other"}}`, false},
+		{"notification of no session", "", `{"jsonrpc":"2.0","method":"notifications/message","params":{"data":"none"}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &notifyingClient{}
+
+			// the session s1 uses the shared client of the stream key
+			var e *echo.Echo
+			s := proxy.NewSSEServer()
+			s.Route(func(router *echo.Echo) {
+				e = router
+				router.Any("/mcp/:key", MCP)
+				router.POST("/setup", func(c echo.Context) error {
+					ctx := proxy.GetSSEContext(c)
+					serverConfig := &mcpserver.ServerConfig{ShareProcess: true}
+					ctx.StoreSession("s1", proxy.NewSSESession(nil, serverConfig, &proxy.ProxyInfo{SessionID: "s1", ServerKey: "stream"}))
+					routeSharedClient(ctx, "stream", client)
+					return c.NoContent(http.StatusOK)
+				})
+			})
+			defer s.Shutdown(time.Second)
+
+			server := httptest.NewServer(e)
+			defer server.Close()
+
+			if _, err := http.Post(server.URL+"/setup", "application/json", nil); err != nil {
+				t.Fatal(err)
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, server.URL+"/mcp/stream", nil)
+			req.Header.Set("Accept", "text/event-stream")
+			req.Header.Set(HeaderMcpSessionID, "s1")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("GET status = %d", resp.StatusCode)
+			}
+
+			client.notify(tt.sessionID, []byte(tt.message))
+
+			received := make(chan string, 1)
+			go func() {
+				scanner := bufio.NewScanner(resp.Body)
+				for scanner.Scan() {
+					if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok && strings.Contains(data, "notifications/") {
+						received <- data
+						return
+					}
+				}
+			}()
+
+			select {
+			case data := <-received:
+				if !tt.want {
+					t.Errorf("GET stream received %s", data)
+				} else if data != tt.message {
+					t.Errorf("GET stream received %s, want %s", data, tt.message)
+				}
+			case <-time.After(300 * time.Millisecond):
+				if tt.want {
+					t.Error("GET stream received nothing")
+				}
+			}
+		})
+	}
+}
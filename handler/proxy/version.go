@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"errors"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+	"github.com/chatmcp/mcprouter/service/proxy"
+	"github.com/labstack/echo/v4"
+)
+
+// negotiateInitialize records the protocol version negotiated with the client, and asks the server for the same
+// version. The server may answer with another version, the proxy then converts between the two.
+func negotiateInitialize(proxyInfo *proxy.ProxyInfo, request *jsonrpc.Request, params *jsonrpc.InitializeParams) error {
+	if params.ProtocolVersion == "" {
+		return jsonrpc.ErrorInvalidParams
+	}
+
+	proxyInfo.ProtocolVersion = jsonrpc.NegotiateProtocolVersion(params.ProtocolVersion)
+
+	if p, ok := request.Params.(map[string]interface{}); ok {
+		p["protocolVersion"] = proxyInfo.ProtocolVersion
+	}
+
+	return nil
+}
+
+// negotiateInitializeResult records the protocol version chosen by the server, and answers the client
+// with the version negotiated with it
+func negotiateInitializeResult(proxyInfo *proxy.ProxyInfo, response *jsonrpc.Response, result *jsonrpc.InitializeResult) error {
+	if !jsonrpc.IsSupportedProtocolVersion(result.ProtocolVersion) {
+		return jsonrpc.NewUnsupportedProtocolVersionError(result.ProtocolVersion)
+	}
+
+	proxyInfo.ServerProtocolVersion = result.ProtocolVersion
+
+	if r, ok := response.Result.(map[string]interface{}); ok && proxyInfo.ProtocolVersion != "" {
+		r["protocolVersion"] = proxyInfo.ProtocolVersion
+	}
+
+	return nil
+}
+
+// initializeError returns the JSON-RPC error for an initialize request or response that could not be processed
+func initializeError(err error) *jsonrpc.Error {
+	var jerr *jsonrpc.Error
+	if errors.As(err, &jerr) {
+		return jerr
+	}
+
+	return jsonrpc.ErrorParseError
+}
+
+// convertResponse converts the result of the server to the protocol version of the client of the session
+func convertResponse(session *proxy.SSESession, request *jsonrpc.Request, response *jsonrpc.Response) {
+	if session == nil || response == nil || response.Result == nil {
+		return
+	}
+
+	proxyInfo := session.ProxyInfo()
+	response.Result = jsonrpc.ConvertResult(request.Method, response.Result, proxyInfo.ServerProtocolVersion, proxyInfo.ProtocolVersion)
+}
+
+// validProtocolVersion checks the MCP-Protocol-Version header of a request against the version negotiated
+// on initialize, a request with no header is assumed to use the negotiated version
+func validProtocolVersion(c echo.Context, negotiated string) bool {
+	version := c.Request().Header.Get(HeaderMcpProtocolVersion)
+	if version == "" {
+		return true
+	}
+
+	return jsonrpc.IsSupportedProtocolVersion(version) && (negotiated == "" || version == negotiated)
+}
@@ -0,0 +1,278 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+	"github.com/chatmcp/mcprouter/service/mcpclient"
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+	"github.com/chatmcp/mcprouter/service/proxy"
+	"github.com/chatmcp/mcprouter/util"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"golang.org/x/net/websocket"
+)
+
+// ErrOriginNotAllowed rejects the websocket handshake of a browser origin that is not allowed
+var ErrOriginNotAllowed = errors.New("origin not allowed")
+
+// WS is a handler for the websocket endpoint, it carries JSON-RPC messages over websocket frames in both directions
+func WS(c echo.Context) error {
+	ctx, err := validateSSEContext(c)
+	if err != nil {
+		return err
+	}
+
+	// No new session is accepted while shutting down
+	if ctx.Draining() {
+		return c.String(http.StatusServiceUnavailable, ErrShuttingDown)
+	}
+
+	// Parse and validate request
+	key, serverConfig, err := validateKeyAndConfig(c)
+	if err != nil || c.Response().Committed {
+		return err
+	}
+
+	server := websocket.Server{
+		Handshake: selectWSProtocol,
+		Handler: func(conn *websocket.Conn) {
+			handleWSConnection(ctx, conn, key, serverConfig)
+		},
+	}
+	server.ServeHTTP(c.Response(), c.Request())
+
+	return nil
+}
+
+// selectWSProtocol rejects browser origins that are not allowed and picks the MCP subprotocol when the client offers it
+func selectWSProtocol(config *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if !allowedWSOrigin(origin, req.Host, viper.GetStringSlice("proxy_server.allowed_origins")) {
+		log.Printf("WS rejected origin %q\n", origin)
+		return ErrOriginNotAllowed
+	}
+
+	for _, protocol := range config.Protocol {
+		if protocol == mcpclient.WSProtocol {
+			config.Protocol = []string{protocol}
+			return nil
+		}
+	}
+
+	if len(config.Protocol) > 0 {
+		config.Protocol = config.Protocol[:1]
+	}
+
+	return nil
+}
+
+// allowedWSOrigin reports whether a websocket handshake from origin is allowed. Clients that are not browsers
+// send no origin, browsers may only connect from the host of the proxy or from an allowed origin.
+func allowedWSOrigin(origin string, host string, allowed []string) bool {
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, host) {
+		return true
+	}
+
+	for _, o := range allowed {
+		if o == "*" || strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handleWSConnection creates the session of the connection and writes its messages to the client
+func handleWSConnection(ctx *proxy.SSEContext, conn *websocket.Conn, key string, serverConfig *mcpserver.ServerConfig) {
+	defer conn.Close()
+
+	// Create base proxy info using common function
+	proxyInfo := createProxyInfo(key, serverConfig)
+
+	// Generate a unique session ID for this connection
+	sessionID := util.GenSessionID()
+	proxyInfo.SessionID = sessionID
+
+	// Create and store session
+	session := proxy.NewSSESession(nil, serverConfig, proxyInfo)
+	ctx.StoreSession(sessionID, session)
+	defer ctx.CloseSession(sessionID)
+
+	// Read client messages until the connection is closed
+	go readWSMessages(ctx, conn, session)
+
+	// The connection is the stream of all the messages of the session
+	listener := session.ListenStandalone()
+	defer session.Unlisten(listener)
+
+	// Main message handling loop
+	for {
+		select {
+		case message := <-listener.Messages():
+			if err := websocket.Message.Send(conn, message); err != nil {
+				log.Printf("WS failed to send message to session %s: %v\n", sessionID, err)
+				session.Close()
+				return
+			}
+		case <-session.Done():
+			log.Printf("Session %s closed\n", sessionID)
+			return
+		}
+	}
+}
+
+// readWSMessages reads the frames of the client, the session is closed when the connection is
+func readWSMessages(ctx *proxy.SSEContext, conn *websocket.Conn, session *proxy.SSESession) {
+	defer session.Close()
+
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(conn, &data); err != nil {
+			if err != io.EOF {
+				log.Printf("WS failed to read message from session %s: %v\n", session.ID(), err)
+			}
+			return
+		}
+
+		handleWSMessage(ctx, session, data)
+	}
+}
+
+// handleWSMessage processes a frame holding a JSON-RPC message or batch, responses are sent back on the connection.
+// Initialize, notifications and responses are processed in order, other requests run concurrently
+// so that server requests can be answered while they are in flight.
+func handleWSMessage(ctx *proxy.SSEContext, session *proxy.SSESession, data []byte) {
+	requests, batch, err := jsonrpc.UnmarshalRequests(data)
+	if err != nil {
+		session.SendMessage(jsonrpc.NewErrorResponse(jsonrpc.ErrorParseError, nil).String())
+		return
+	}
+
+	if batch {
+		// Batches were removed in protocol version 2025-06-18
+		if len(requests) == 0 || !jsonrpc.SupportsBatch(session.ProxyInfo().ProtocolVersion) {
+			session.SendMessage(jsonrpc.NewErrorResponse(jsonrpc.ErrorInvalidRequest, nil).String())
+			return
+		}
+
+		go processWSBatch(ctx, session, requests)
+		return
+	}
+
+	request := requests[0]
+	if request.ID == nil || request.IsResponse() || request.Method == MethodInitialize {
+		if response := processWSRequest(ctx, session, request); response != nil {
+			session.SendMessage(response.String())
+		}
+		return
+	}
+
+	go func() {
+		if response := processWSRequest(ctx, session, request); response != nil {
+			session.SendMessage(response.String())
+		}
+	}()
+}
+
+// processWSBatch forwards the requests of a batch in parallel and sends their responses as one message
+func processWSBatch(ctx *proxy.SSEContext, session *proxy.SSESession, requests []*jsonrpc.Request) {
+	responses := make([]*jsonrpc.Response, len(requests))
+
+	var wg sync.WaitGroup
+	for i, request := range requests {
+		if request.Invalid() {
+			responses[i] = jsonrpc.NewErrorResponse(jsonrpc.ErrorInvalidRequest, request.ID)
+			continue
+		}
+
+		// Initialize must not be part of a batch
+		if request.Method == MethodInitialize {
+			responses[i] = jsonrpc.NewErrorResponse(jsonrpc.ErrorInvalidRequest, request.ID)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, request *jsonrpc.Request) {
+			defer wg.Done()
+			responses[i] = processWSRequest(ctx, session, request)
+		}(i, request)
+	}
+	wg.Wait()
+
+	// Notifications and responses get no reply
+	results := make([]*jsonrpc.Response, 0, len(responses))
+	for _, response := range responses {
+		if response != nil {
+			results = append(results, response)
+		}
+	}
+
+	if len(results) == 0 {
+		return
+	}
+
+	if b, err := json.Marshal(results); err == nil {
+		session.SendMessage(string(b))
+	}
+}
+
+// processWSRequest forwards a client message with MCP client and returns the response to send, if any
+func processWSRequest(ctx *proxy.SSEContext, session *proxy.SSESession, request *jsonrpc.Request) *jsonrpc.Response {
+	// Route client responses to server-initiated requests
+	if request.IsResponse() {
+		session.Respond(request.Response())
+		return nil
+	}
+
+	// Each request is logged with its own copy of the session proxy info
+	proxyInfo := *session.ProxyInfo()
+	proxyInfo.JSONRPCVersion = request.JSONRPC
+	proxyInfo.RequestMethod = request.Method
+	proxyInfo.RequestTime = time.Now()
+	proxyInfo.RequestParams = request.Params
+	proxyInfo.RequestID = request.ID
+
+	// Handle initialize method specially
+	if request.Method == MethodInitialize {
+		if err := applyInitializeParams(session, &proxyInfo, request); err != nil {
+			return jsonrpc.NewErrorResponse(initializeError(err), request.ID)
+		}
+	}
+
+	response, err := processMessageWithClient(ctx, session, session.Key(), request)
+	if err != nil {
+		// Cancelled requests get no response
+		if request.ID == nil || errors.Is(err, context.Canceled) {
+			return nil
+		}
+		response = jsonrpc.NewErrorResponse(forwardError(err), request.ID)
+	}
+
+	if request.Method == MethodInitialize && response != nil && response.Result != nil {
+		if err := processInitializeResponse(session, &proxyInfo, response); err != nil {
+			response = jsonrpc.NewErrorResponse(initializeError(err), request.ID)
+		}
+	}
+
+	finishMessage(&proxyInfo, response)
+
+	return response
+}
@@ -0,0 +1,28 @@
+package proxy
+
+import "testing"
+
+func TestAllowedWSOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{"no origin", "", nil, true},
+		{"proxy host", "http://proxy.local:8025", nil, true},
+		{"other origin", "https://evil.example", nil, false},
+		{"allowed origin", "https://app.example", []string{"https://app.example/"}, true},
+		{"allowed origin other scheme", "http://app.example", []string{"https://app.example"}, false},
+		{"any origin", "https://evil.example", []string{"*"}, true},
+		{"invalid origin", "null", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allowedWSOrigin(tt.origin, "proxy.local:8025", tt.allowed); got != tt.want {
+				t.Errorf("allowedWSOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
@@ -17,6 +17,10 @@ type Server struct {
 	Content     string    `json:"content"`
 	ServerKey   string    `json:"server_key"`
 	ServerURL   string    `json:"-"`
+	Command     string    `json:"-"`
+	Args        string    `json:"-"` // JSON array
+	Env         string    `json:"-"` // JSON object
+	Cwd         string    `json:"-"`
 	ConfigName  string    `json:"config_name"`
 	Tools       []*Tool   `json:"tools,omitempty" gorm:"-"`
 }
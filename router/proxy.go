@@ -12,6 +12,10 @@ func ProxyRoute(e *echo.Echo) {
 	e.POST("/messages", proxy.Messages)
 	// streamable http proxy
 	e.Any("/mcp/:key", proxy.MCP)
+	// websocket proxy
+	e.GET("/ws/:key", proxy.WS)
+	// recent stderr of the backends, for operators
+	e.GET("/stderr/:key", proxy.Stderr)
 
 	e.Any("/:key", proxy.MCP)
 }
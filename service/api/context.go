@@ -108,8 +108,8 @@ func (c *APIContext) Connect(key string) (mcpclient.Client, error) {
 		ServerCommandHash:  serverConfig.CommandHash,
 		ConnectionTime:     time.Now(),
 		RequestTime:        time.Now(),
-		RequestID:          header.Get("X-Request-ID"),
 		RequestFrom:        header.Get("X-Request-From"),
+		HeaderRequestID:    header.Get("X-Request-ID"),
 	}
 
 	client, err := mcpclient.NewClient(serverConfig)
@@ -118,8 +118,8 @@ func (c *APIContext) Connect(key string) (mcpclient.Client, error) {
 	}
 
 	// initialize get server info
-	result, err := client.Initialize(&jsonrpc.InitializeParams{
-		ProtocolVersion: jsonrpc.JSONRPC_VERSION,
+	result, err := client.Initialize(c.Request().Context(), &jsonrpc.InitializeParams{
+		ProtocolVersion: jsonrpc.LATEST_PROTOCOL_VERSION,
 		Capabilities: jsonrpc.ClientCapabilities{
 			Experimental: map[string]interface{}{
 				"auth": map[string]interface{}{},
@@ -136,14 +136,20 @@ func (c *APIContext) Connect(key string) (mcpclient.Client, error) {
 		return nil, fmt.Errorf("connection initialize failed")
 	}
 
+	if !jsonrpc.IsSupportedProtocolVersion(result.ProtocolVersion) {
+		client.Close()
+		return nil, fmt.Errorf("unsupported protocol version: %s", result.ProtocolVersion)
+	}
+
 	proxyInfo.ServerName = result.ServerInfo.Name
 	proxyInfo.ServerVersion = result.ServerInfo.Version
 	proxyInfo.JSONRPCVersion = jsonrpc.JSONRPC_VERSION
 	proxyInfo.ProtocolVersion = result.ProtocolVersion
+	proxyInfo.ServerProtocolVersion = result.ProtocolVersion
 
 	c.SetProxyInfo(proxyInfo)
 
-	if err := client.NotificationsInitialized(); err != nil {
+	if err := client.NotificationsInitialized(c.Request().Context()); err != nil {
 		client.Close()
 		return nil, fmt.Errorf("connection notifications initialized failed")
 	}
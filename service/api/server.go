@@ -1,8 +1,14 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"time"
 
+	"github.com/chatmcp/mcprouter/service/mcpclient"
+	"github.com/chatmcp/mcprouter/util"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
@@ -28,7 +34,32 @@ func (s *APIServer) Route(route func(e *echo.Echo)) {
 	route(s.server)
 }
 
-// Start will start the http server
-func (s *APIServer) Start(port int) {
-	s.server.Logger.Fatal(s.server.Start(fmt.Sprintf(":%d", port)))
+// Start will start the http server, it shuts down gracefully on SIGINT or SIGTERM
+func (s *APIServer) Start(port int, shutdownTimeout time.Duration) {
+	go func() {
+		if err := s.server.Start(fmt.Sprintf(":%d", port)); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.server.Logger.Fatal(err)
+		}
+	}()
+
+	sig := util.WaitForShutdownSignal()
+	fmt.Printf("received %s, shutting down\n", sig)
+
+	s.Shutdown(shutdownTimeout)
+}
+
+// Shutdown will stop accepting requests, wait for the in-flight ones up to the timeout
+// and kill the backend processes left
+func (s *APIServer) Shutdown(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := s.server.Shutdown(ctx); err != nil {
+		fmt.Printf("failed to shutdown server: %v\n", err)
+		s.server.Close()
+	}
+
+	mcpclient.KillProcesses()
+
+	fmt.Println("server shutdown")
 }
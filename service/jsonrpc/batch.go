@@ -0,0 +1,63 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// IsBatch reports whether the message is a JSON-RPC batch.
+func IsBatch(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+
+	return len(data) > 0 && data[0] == '['
+}
+
+// UnmarshalBatch unmarshals a JSON-RPC batch. Each element is decoded on its own, an element that is not
+// a valid request is returned as an invalid request with the id it carries, if any.
+func UnmarshalBatch(data []byte) ([]*Request, error) {
+	var elements []json.RawMessage
+
+	if err := unmarshal(data, &elements); err != nil {
+		return nil, err
+	}
+
+	requests := make([]*Request, 0, len(elements))
+	for _, element := range elements {
+		requests = append(requests, unmarshalBatchElement(element))
+	}
+
+	return requests, nil
+}
+
+// unmarshalBatchElement unmarshals an element of a batch, a request needs a method unless it is a response
+func unmarshalBatchElement(element json.RawMessage) *Request {
+	request, err := UnmarshalRequest(element)
+	if err == nil && (request.Method != "" || request.IsResponse()) {
+		return request
+	}
+
+	var base struct {
+		ID interface{} `json:"id"`
+	}
+	_ = unmarshal(element, &base)
+
+	return &Request{
+		BaseRequest: BaseRequest{JSONRPC: JSONRPC_VERSION, ID: base.ID},
+		invalid:     true,
+	}
+}
+
+// UnmarshalRequests unmarshals a JSON-RPC request or batch, batch reports whether the message is a batch.
+func UnmarshalRequests(data []byte) (requests []*Request, batch bool, err error) {
+	if IsBatch(data) {
+		requests, err = UnmarshalBatch(data)
+		return requests, true, err
+	}
+
+	request, err := UnmarshalRequest(data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return []*Request{request}, false, nil
+}
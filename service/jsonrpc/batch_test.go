@@ -0,0 +1,58 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshalRequests(t *testing.T) {
+	type element struct {
+		method  string
+		id      interface{}
+		invalid bool
+	}
+
+	tests := []struct {
+		name      string
+		data      string
+		wantBatch bool
+		want      []element
+		wantErr   bool
+	}{
+		{"request", `{"jsonrpc":"2.0","id":1,"method":"ping"}`, false, []element{{"ping", json.Number("1"), false}}, false},
+		{"string id", `{"jsonrpc":"2.0","id":"1","method":"ping"}`, false, []element{{"ping", "1", false}}, false},
+		{"notification", `{"jsonrpc":"2.0","method":"notifications/initialized"}`, false, []element{{"notifications/initialized", nil, false}}, false},
+		{"invalid json", `{"jsonrpc":`, false, nil, true},
+		{"batch", ` [{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","method":"notifications/initialized"}]`, true, []element{{"ping", json.Number("1"), false}, {"notifications/initialized", nil, false}}, false},
+		{"empty batch", `[]`, true, []element{}, false},
+		{"invalid batch json", `[{"jsonrpc":"2.0"`, true, nil, true},
+		{"batch of non objects", `[1,"a",null]`, true, []element{{"", nil, true}, {"", nil, true}, {"", nil, true}}, false},
+		{"invalid element keeps its id", `[{"jsonrpc":"2.0","id":7,"method":5},{"jsonrpc":"2.0","id":8,"method":"ping"}]`, true, []element{{"", json.Number("7"), true}, {"ping", json.Number("8"), false}}, false},
+		{"element with no method", `[{"jsonrpc":"2.0","id":"a"}]`, true, []element{{"", "a", true}}, false},
+		{"response element", `[{"jsonrpc":"2.0","id":"mcprouter-1","result":{}}]`, true, []element{{"", "mcprouter-1", false}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests, batch, err := UnmarshalRequests([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalRequests() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if batch != tt.wantBatch {
+				t.Errorf("UnmarshalRequests() batch = %v, want %v", batch, tt.wantBatch)
+			}
+			if err != nil {
+				return
+			}
+
+			got := make([]element, 0, len(requests))
+			for _, request := range requests {
+				got = append(got, element{request.Method, request.ID, request.Invalid()})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnmarshalRequests() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
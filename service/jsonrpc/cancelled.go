@@ -0,0 +1,15 @@
+package jsonrpc
+
+// CancelledParams is the params for the cancelled notification.
+type CancelledParams struct {
+	RequestID interface{} `json:"requestId"`
+	Reason    string      `json:"reason,omitempty"`
+}
+
+// NewCancelledNotification creates a cancelled notification for the request id.
+func NewCancelledNotification(requestID interface{}, reason string) *Notification {
+	return NewNotification(MethodCancelledNotification, &CancelledParams{
+		RequestID: requestID,
+		Reason:    reason,
+	})
+}
@@ -0,0 +1,108 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ConvertResult converts the result of a method from the wire format of the server protocol version
+// to the one of the client protocol version. Newer versions only add to the older formats,
+// so a result is converted when the client speaks an older version than the server only.
+func ConvertResult(method string, result interface{}, from string, to string) interface{} {
+	if result == nil || from == "" || to == "" || from <= to {
+		return result
+	}
+
+	if method != MethodListTools && method != MethodCallTool {
+		return result
+	}
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		return result
+	}
+
+	var m map[string]interface{}
+	if err := unmarshal(b, &m); err != nil || m == nil {
+		return result
+	}
+
+	switch method {
+	case MethodListTools:
+		convertTools(m, to)
+	case MethodCallTool:
+		convertCallToolResult(m, to)
+	}
+
+	return m
+}
+
+// convertTools drops the tool fields the protocol version does not know
+func convertTools(result map[string]interface{}, to string) {
+	tools, _ := result["tools"].([]interface{})
+	for _, t := range tools {
+		tool, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if to < PROTOCOL_VERSION_2025_06_18 {
+			delete(tool, "outputSchema")
+			delete(tool, "title")
+		}
+
+		if to < PROTOCOL_VERSION_2025_03_26 {
+			delete(tool, "annotations")
+		}
+	}
+}
+
+// convertCallToolResult maps structured tool output and the newer content types to their older form
+func convertCallToolResult(result map[string]interface{}, to string) {
+	content, _ := result["content"].([]interface{})
+
+	// Structured content is serialized as text for clients without structured tool output
+	if structured, ok := result["structuredContent"]; ok && to < PROTOCOL_VERSION_2025_06_18 {
+		if len(content) == 0 {
+			if b, err := json.Marshal(structured); err == nil {
+				content = append(content, map[string]interface{}{
+					"type": "text",
+					"text": string(b),
+				})
+			}
+		}
+		delete(result, "structuredContent")
+	}
+
+	for i, c := range content {
+		if item, ok := c.(map[string]interface{}); ok {
+			content[i] = convertContent(item, to)
+		}
+	}
+
+	if content != nil {
+		result["content"] = content
+	}
+}
+
+// convertContent maps a content item of a type the protocol version does not know to text
+func convertContent(item map[string]interface{}, to string) map[string]interface{} {
+	switch item["type"] {
+	case "resource_link":
+		if to < PROTOCOL_VERSION_2025_06_18 {
+			return map[string]interface{}{
+				"type": "text",
+				"text": fmt.Sprintf("%v", item["uri"]),
+			}
+		}
+	case "audio":
+		if to < PROTOCOL_VERSION_2025_03_26 {
+			return map[string]interface{}{
+				"type": "text",
+				"text": fmt.Sprintf("[audio: %v]", item["mimeType"]),
+			}
+		}
+	}
+
+	return item
+}
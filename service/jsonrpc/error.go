@@ -41,4 +41,13 @@ var (
 
 	// ErrorProxyError is the error returned when the proxy error occurs.
 	ErrorProxyError = NewError(-32000, "Proxy error, Please restart client", nil)
+
+	// ErrorRequestTimeout is the error returned when the server does not respond in time.
+	ErrorRequestTimeout = NewError(-32001, "Request timed out", nil)
+
+	// ErrorServerRestarting is the error returned when the server exited with the request in flight and is being restarted.
+	ErrorServerRestarting = NewError(-32003, "Server restarting, please retry", nil)
+
+	// ErrorRequestCancelled is the error returned when the request is cancelled before the server responds.
+	ErrorRequestCancelled = NewError(-32800, "Request cancelled", nil)
 )
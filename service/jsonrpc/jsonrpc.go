@@ -1,10 +1,15 @@
 package jsonrpc
 
+import (
+	"bytes"
+	"encoding/json"
+)
+
 // JSONRPC_VERSION is the version of the JSON-RPC protocol.
 const JSONRPC_VERSION = "2.0"
 
 // LATEST_PROTOCOL_VERSION is the latest protocol version.
-const LATEST_PROTOCOL_VERSION = "2024-11-05"
+const LATEST_PROTOCOL_VERSION = PROTOCOL_VERSION_2025_06_18
 
 // PROXY_SERVER_NAME is the name of the proxy server.
 const PROXY_SERVER_NAME = "mcprouter-server"
@@ -17,3 +22,12 @@ const PROXY_CLIENT_NAME = "mcprouter-client"
 
 // PROXY_CLIENT_VERSION is the version of the proxy client.
 const PROXY_CLIENT_VERSION = "1.0.0"
+
+// unmarshal decodes a JSON-RPC message, keeping numbers as json.Number
+// so that request IDs of any type round-trip exactly.
+func unmarshal(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	return decoder.Decode(v)
+}
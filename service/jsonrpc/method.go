@@ -3,6 +3,18 @@ package jsonrpc
 const (
 	MethodInitialize              = "initialize"
 	MethodInitializedNotification = "notifications/initialized"
+	MethodCancelledNotification   = "notifications/cancelled"
+	MethodProgressNotification    = "notifications/progress"
+	MethodResourceUpdated         = "notifications/resources/updated"
+	MethodPing                    = "ping"
 	MethodListTools               = "tools/list"
 	MethodCallTool                = "tools/call"
+	MethodListPrompts             = "prompts/list"
+	MethodGetPrompt               = "prompts/get"
+	MethodListResources           = "resources/list"
+	MethodListResourceTemplates   = "resources/templates/list"
+	MethodReadResource            = "resources/read"
+	MethodSubscribeResource       = "resources/subscribe"
+	MethodUnsubscribeResource     = "resources/unsubscribe"
+	MethodComplete                = "completion/complete"
 )
@@ -1,7 +1,5 @@
 package jsonrpc
 
-import "encoding/json"
-
 // Notification is a JSON-RPC notification.
 type Notification struct {
 	BaseRequest
@@ -23,7 +21,7 @@ func NewNotification(method string, params interface{}) *Notification {
 func UnmarshalNotification(data []byte) (*Notification, error) {
 	var n Notification
 
-	if err := json.Unmarshal(data, &n); err != nil {
+	if err := unmarshal(data, &n); err != nil {
 		return nil, err
 	}
 
@@ -1,13 +1,13 @@
 package jsonrpc
 
-import "encoding/json"
-
 // Request is a JSON-RPC request.
 type Request struct {
 	BaseRequest
 	Params interface{} `json:"params,omitempty"`
 	Result interface{} `json:"result,omitempty"`
 	Error  *Error      `json:"error,omitempty"`
+
+	invalid bool // the batch element is not a valid request
 }
 
 // NewRequest creates a new JSON-RPC request.
@@ -22,11 +22,34 @@ func NewRequest(method string, params interface{}, id interface{}) *Request {
 	}
 }
 
+// IsResponse reports whether the message is a response of the client to a server-initiated request.
+func (r *Request) IsResponse() bool {
+	return r.Method == "" && (r.Result != nil || r.Error != nil)
+}
+
+// Invalid reports whether the message is a batch element that is not a valid request,
+// it is answered with an Invalid Request error.
+func (r *Request) Invalid() bool {
+	return r.invalid
+}
+
+// Response converts the message to a JSON-RPC response.
+func (r *Request) Response() *Response {
+	return &Response{
+		BaseResponse: BaseResponse{
+			JSONRPC: r.JSONRPC,
+			ID:      r.ID,
+		},
+		Result: r.Result,
+		Error:  r.Error,
+	}
+}
+
 // UnmarshalRequest unmarshals a JSON-RPC request.
 func UnmarshalRequest(data []byte) (*Request, error) {
 	var r Request
 
-	if err := json.Unmarshal(data, &r); err != nil {
+	if err := unmarshal(data, &r); err != nil {
 		return nil, err
 	}
 
@@ -52,7 +52,7 @@ func NewErrorResponse(err *Error, id interface{}) *Response {
 func UnmarshalResponse(data []byte) (*Response, error) {
 	var j Response
 
-	if err := json.Unmarshal(data, &j); err != nil {
+	if err := unmarshal(data, &j); err != nil {
 		return nil, err
 	}
 
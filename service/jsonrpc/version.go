@@ -0,0 +1,50 @@
+package jsonrpc
+
+// Protocol versions of MCP, named by their release date.
+const (
+	PROTOCOL_VERSION_2024_11_05 = "2024-11-05"
+	PROTOCOL_VERSION_2025_03_26 = "2025-03-26"
+	PROTOCOL_VERSION_2025_06_18 = "2025-06-18"
+)
+
+// SUPPORTED_PROTOCOL_VERSIONS are the protocol versions the proxy speaks, oldest first.
+var SUPPORTED_PROTOCOL_VERSIONS = []string{
+	PROTOCOL_VERSION_2024_11_05,
+	PROTOCOL_VERSION_2025_03_26,
+	PROTOCOL_VERSION_2025_06_18,
+}
+
+// IsSupportedProtocolVersion reports whether the proxy speaks the protocol version.
+func IsSupportedProtocolVersion(version string) bool {
+	for _, v := range SUPPORTED_PROTOCOL_VERSIONS {
+		if v == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NegotiateProtocolVersion returns the protocol version to answer a client requesting the given version with:
+// the requested version when it is supported, the latest version otherwise.
+func NegotiateProtocolVersion(requested string) string {
+	if IsSupportedProtocolVersion(requested) {
+		return requested
+	}
+
+	return LATEST_PROTOCOL_VERSION
+}
+
+// SupportsBatch reports whether JSON-RPC batches are allowed by the protocol version,
+// they were removed in 2025-06-18. An unknown version allows them.
+func SupportsBatch(version string) bool {
+	return version == "" || version < PROTOCOL_VERSION_2025_06_18
+}
+
+// NewUnsupportedProtocolVersionError creates the error returned for a protocol version the proxy does not speak.
+func NewUnsupportedProtocolVersionError(requested string) *Error {
+	return NewError(ErrorInvalidParams.Code, "Unsupported protocol version", map[string]interface{}{
+		"supported": SUPPORTED_PROTOCOL_VERSIONS,
+		"requested": requested,
+	})
+}
@@ -1,6 +1,7 @@
 package mcpclient
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strings"
@@ -10,27 +11,67 @@ import (
 )
 
 // Client is a client that can send and receive messages to and from the server.
+// When the context of a request is done, the waiter is released and the server is told to cancel it.
 type Client interface {
 	Error() error
 	Close() error
-	OnNotification(handler func(message []byte))
-	SendMessage(message []byte) ([]byte, error)
-	ForwardMessage(request *jsonrpc.Request) (*jsonrpc.Response, error)
-	Initialize(params *jsonrpc.InitializeParams) (*jsonrpc.InitializeResult, error)
-	NotificationsInitialized() error
-	ListTools() (*jsonrpc.ListToolsResult, error)
-	CallTool(params *jsonrpc.CallToolParams) (*jsonrpc.CallToolResult, error)
+	OnNotification(handler NotificationHandler)
+	OnRequest(handler RequestHandler)
+	SendMessage(ctx context.Context, message []byte) ([]byte, error)
+	ForwardMessage(ctx context.Context, request *jsonrpc.Request) (*jsonrpc.Response, error)
+	Initialize(ctx context.Context, params *jsonrpc.InitializeParams) (*jsonrpc.InitializeResult, error)
+	NotificationsInitialized(ctx context.Context) error
+	ListTools(ctx context.Context) (*jsonrpc.ListToolsResult, error)
+	CallTool(ctx context.Context, params *jsonrpc.CallToolParams) (*jsonrpc.CallToolResult, error)
+}
+
+// NotificationHandler handles a notification of the backend server, sessionID is the downstream session
+// it is meant for, empty when it cannot be tied to one session.
+type NotificationHandler func(sessionID string, message []byte)
+
+// SessionBinder is implemented by clients that can pin a downstream session to one backend.
+type SessionBinder interface {
+	BindSession(sessionID string) Client
+	ReleaseSession(sessionID string)
+}
+
+// BindSession returns the client to use for the given session
+func BindSession(client Client, sessionID string) Client {
+	if binder, ok := client.(SessionBinder); ok {
+		return binder.BindSession(sessionID)
+	}
+
+	return client
+}
+
+// ReleaseSession releases the backend pinned to the given session
+func ReleaseSession(client Client, sessionID string) {
+	if binder, ok := client.(SessionBinder); ok {
+		binder.ReleaseSession(sessionID)
+	}
 }
 
 // NewClient creates a new client
 func NewClient(serverConfig *mcpserver.ServerConfig) (Client, error) {
 	log.Printf("new client with server config: %+v\n", serverConfig)
 
+	if serverConfig.Composite() {
+		return NewCompositeClient(serverConfig, nil)
+	}
+
 	if serverConfig.ServerURL != "" {
+		if strings.HasPrefix(serverConfig.ServerURL, "ws://") || strings.HasPrefix(serverConfig.ServerURL, "wss://") {
+			return NewWSClient(serverConfig)
+		}
+
 		if !strings.HasPrefix(serverConfig.ServerURL, "http") {
 			return nil, fmt.Errorf("invalid server url")
 		}
 
+		if serverConfig.ServerType == "sse" {
+			return NewSSEClient(serverConfig)
+		}
+
 		return NewRestClient(serverConfig)
 	}
 
@@ -38,5 +79,9 @@ func NewClient(serverConfig *mcpserver.ServerConfig) (Client, error) {
 		return nil, fmt.Errorf("invalid command")
 	}
 
-	return NewStdioClient(serverConfig)
+	if serverConfig.MaxInstances > 1 {
+		return NewPoolClient(serverConfig)
+	}
+
+	return NewSupervisedClient(serverConfig)
 }
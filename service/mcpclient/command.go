@@ -0,0 +1,128 @@
+package mcpclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+)
+
+// paramPlaceholder matches the {{name}} placeholders of env values
+var paramPlaceholder = regexp.MustCompile(`\{\{\s*([\w.-]+)\s*\}\}`)
+
+// newCommand builds the command of the stdio server with its sandbox, the temporary directory created
+// for the process is returned to be removed once it exits
+func newCommand(serverConfig *mcpserver.ServerConfig) (cmd *exec.Cmd, tempDir string, err error) {
+	sandbox := serverConfig.Sandbox
+
+	name, args := commandArgs(serverConfig)
+
+	if sandbox != nil {
+		if runtime.GOOS == "windows" {
+			return nil, "", fmt.Errorf("sandbox is not supported on windows")
+		}
+
+		// limits are set by a shell before it runs the command, the command fails when they cannot be set
+		if limits := ulimitCommands(sandbox); limits != "" {
+			script := fmt.Sprintf("%s || exit 125\nexec \"$0\" \"$@\"", limits)
+			name, args = "sh", append([]string{"-c", script, name}, args...)
+		}
+	}
+
+	cmd = exec.Command(name, args...)
+	setProcessGroup(cmd)
+
+	cmd.Dir = serverConfig.Cwd
+	cmd.Env = os.Environ()
+
+	if sandbox != nil {
+		// the work dir of the sandbox wins over the cwd of the server, the temporary directory
+		// is the working directory when neither is set and is the home of the process otherwise
+		if sandbox.TempDir {
+			tempDir, err = os.MkdirTemp("", "mcprouter-")
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to create temp dir: %w", err)
+			}
+			if cmd.Dir == "" {
+				cmd.Dir = tempDir
+			}
+		}
+		if sandbox.WorkDir != "" {
+			cmd.Dir = sandbox.WorkDir
+		}
+
+		cmd.Env = sandboxEnv(sandbox, tempDir)
+
+		if err := isolate(cmd, sandbox, tempDir); err != nil {
+			if tempDir != "" {
+				os.RemoveAll(tempDir)
+			}
+			return nil, "", err
+		}
+	}
+
+	cmd.Env = append(cmd.Env, serverEnv(serverConfig)...)
+
+	return cmd, tempDir, nil
+}
+
+// legacyCommands holds the command lines already warned about running with the shell without shell set
+var legacyCommands sync.Map
+
+// commandArgs returns the program and the arguments to run the server with. A command given with args runs
+// directly, a command with no args is a command line run by the shell, as is any command when shell is set.
+// The args of a shell command are its positional parameters, $1 and on.
+func commandArgs(serverConfig *mcpserver.ServerConfig) (string, []string) {
+	if len(serverConfig.Args) > 0 && !serverConfig.Shell {
+		return serverConfig.Command, serverConfig.Args
+	}
+
+	if !serverConfig.Shell && strings.ContainsAny(serverConfig.Command, " \t") {
+		if _, warned := legacyCommands.LoadOrStore(serverConfig.Command, true); !warned {
+			fmt.Printf("deprecated: command of %s is run by the shell, set shell = true or give its args: %s\n",
+				serverConfig.ServerKey, serverConfig.Command)
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		return "cmd.exe", append([]string{"/C", serverConfig.Command}, serverConfig.Args...)
+	}
+
+	return "sh", append([]string{"-c", serverConfig.Command, "sh"}, serverConfig.Args...)
+}
+
+// serverEnv returns the env of the server config, with the {{name}} placeholders replaced with the server params
+func serverEnv(serverConfig *mcpserver.ServerConfig) []string {
+	if len(serverConfig.Env) == 0 {
+		return nil
+	}
+
+	params := map[string]interface{}{}
+	if serverConfig.ServerParams != "" {
+		if err := json.Unmarshal([]byte(serverConfig.ServerParams), &params); err != nil {
+			fmt.Printf("failed to unmarshal server params: %v\n", err)
+		}
+	}
+
+	env := make([]string, 0, len(serverConfig.Env))
+	for name, value := range serverConfig.Env {
+		value = paramPlaceholder.ReplaceAllStringFunc(value, func(placeholder string) string {
+			key := paramPlaceholder.FindStringSubmatch(placeholder)[1]
+			param, ok := params[key]
+			if !ok {
+				fmt.Printf("missing server param %s for env %s\n", key, name)
+				return ""
+			}
+			return fmt.Sprintf("%v", param)
+		})
+		env = append(env, name+"="+value)
+	}
+
+	return env
+}
@@ -0,0 +1,106 @@
+package mcpclient
+
+import (
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+)
+
+func TestCommandArgs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell commands run with cmd.exe on windows")
+	}
+
+	tests := []struct {
+		name     string
+		config   mcpserver.ServerConfig
+		wantName string
+		wantArgs []string
+	}{
+		{"legacy command line", mcpserver.ServerConfig{Command: "npx -y @scope/server --dir '/a b'"}, "sh", []string{"-c", "npx -y @scope/server --dir '/a b'", "sh"}},
+		{"legacy command with shell syntax", mcpserver.ServerConfig{Command: "cd /srv && ./server.sh 2>/dev/null"}, "sh", []string{"-c", "cd /srv && ./server.sh 2>/dev/null", "sh"}},
+		{"command and args", mcpserver.ServerConfig{Command: "python3", Args: []string{"server.py", "a b", "$HOME"}}, "python3", []string{"server.py", "a b", "$HOME"}},
+		{"shell set", mcpserver.ServerConfig{Command: "./server.sh | tee log", Shell: true}, "sh", []string{"-c", "./server.sh | tee log", "sh"}},
+		{"shell set with args", mcpserver.ServerConfig{Command: `exec ./server.sh --dir "$1"`, Args: []string{"/a b"}, Shell: true}, "sh", []string{"-c", `exec ./server.sh --dir "$1"`, "sh", "/a b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, args := commandArgs(&tt.config)
+			if name != tt.wantName || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("commandArgs() = %s %q, want %s %q", name, args, tt.wantName, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestServerEnv(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    map[string]string
+		params string
+		want   []string
+	}{
+		{"no env", nil, "", nil},
+		{"case kept", map[string]string{"My_Token": "x", "lower": "y"}, "", []string{"My_Token=x", "lower=y"}},
+		{"placeholders", map[string]string{"TOKEN": "Bearer {{ token }}", "ID": "{{id}}"}, `{"token":"abc","id":7}`, []string{"ID=7", "TOKEN=Bearer abc"}},
+		{"missing param", map[string]string{"TOKEN": "{{token}}"}, `{}`, []string{"TOKEN="}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := serverEnv(&mcpserver.ServerConfig{Env: tt.env, ServerParams: tt.params})
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("serverEnv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCommandDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sandbox is not supported on windows")
+	}
+
+	tests := []struct {
+		name     string
+		cwd      string
+		sandbox  *mcpserver.SandboxConfig
+		want     string // "temp" for the temporary directory
+		wantTemp bool
+	}{
+		{"no sandbox", "/srv", nil, "/srv", false},
+		{"temp dir", "", &mcpserver.SandboxConfig{TempDir: true}, "temp", true},
+		{"cwd wins over the temp dir", "/srv", &mcpserver.SandboxConfig{TempDir: true}, "/srv", true},
+		{"work dir wins over the cwd", "/srv", &mcpserver.SandboxConfig{TempDir: true, WorkDir: "/work"}, "/work", true},
+		{"work dir", "", &mcpserver.SandboxConfig{WorkDir: "/work"}, "/work", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, tempDir, err := newCommand(&mcpserver.ServerConfig{Command: "true", Cwd: tt.cwd, Sandbox: tt.sandbox})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tempDir != "" {
+				defer os.RemoveAll(tempDir)
+			}
+
+			if (tempDir != "") != tt.wantTemp {
+				t.Errorf("temp dir = %q, want one: %v", tempDir, tt.wantTemp)
+			}
+			want := tt.want
+			if want == "temp" {
+				want = tempDir
+			}
+			if cmd.Dir != want {
+				t.Errorf("dir = %q, want %q", cmd.Dir, want)
+			}
+		})
+	}
+}
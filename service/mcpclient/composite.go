@@ -0,0 +1,772 @@
+package mcpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	defaultNamespaceSeparator = "__"
+
+	compositeServerName    = "mcprouter-composite"
+	compositeServerVersion = "0.1.0"
+
+	// maxListPages bounds the pages fetched from a member for one list request
+	maxListPages = 100
+)
+
+// SharedClientFunc returns the shared client of a server key, connecting it when there is none
+type SharedClientFunc func(key string, serverConfig *mcpserver.ServerConfig) (Client, error)
+
+// compositeMember is a server combined in a composite server
+type compositeMember struct {
+	key          string
+	prefix       string
+	serverConfig *mcpserver.ServerConfig
+	client       Client            // client owned by the composite for a member sharing its process, nil with shared clients
+	sessions     map[string]Client // instances of a member not sharing its process, by composite session
+	mu           sync.Mutex
+}
+
+// CompositeClient is a client that exposes the tools, prompts and resources of several servers as one.
+// Names are namespaced with the prefix of their member, requests are routed back to the member by prefix.
+// Resources keep their uri and are routed by the member that listed them.
+// Members sharing their process use the shared client of their key, the others run one instance per composite session.
+type CompositeClient struct {
+	serverConfig  *mcpserver.ServerConfig
+	shared        SharedClientFunc
+	members       []*compositeMember
+	byPrefix      map[string]*compositeMember
+	separator     string
+	resources     map[string]*compositeMember // listed resources, by uri
+	rmu           sync.RWMutex
+	notifications []NotificationHandler // notification handlers
+	requests      RequestHandler        // server request handler
+	nmu           sync.RWMutex
+}
+
+// NewCompositeClient connects to the member servers of the composite server. Members sharing their process
+// use the client shared returns, a client of the composite when shared is nil.
+func NewCompositeClient(serverConfig *mcpserver.ServerConfig, shared SharedClientFunc) (*CompositeClient, error) {
+	if len(serverConfig.Members) == 0 {
+		return nil, errors.New("composite server has no members")
+	}
+
+	separator := serverConfig.Separator
+	if separator == "" {
+		separator = defaultNamespaceSeparator
+	}
+
+	c := &CompositeClient{
+		serverConfig: serverConfig,
+		shared:       shared,
+		byPrefix:     make(map[string]*compositeMember),
+		separator:    separator,
+		resources:    make(map[string]*compositeMember),
+	}
+
+	for _, key := range serverConfig.Members {
+		member, err := c.connect(key)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+
+		c.members = append(c.members, member)
+		c.byPrefix[member.prefix] = member
+	}
+
+	return c, nil
+}
+
+// connect connects to the member server of the given key
+func (c *CompositeClient) connect(key string) (*compositeMember, error) {
+	prefix := key
+	if p, ok := c.serverConfig.Prefixes[key]; ok && p != "" {
+		prefix = p
+	}
+
+	// names are split at the first separator, so a prefix cannot contain it
+	if strings.Contains(prefix, c.separator) {
+		return nil, fmt.Errorf("prefix %s of member %s contains the separator %s", prefix, key, c.separator)
+	}
+	if _, ok := c.byPrefix[prefix]; ok {
+		return nil, fmt.Errorf("prefix %s of member %s is used by another member", prefix, key)
+	}
+
+	serverConfig := mcpserver.GetServerConfig(key)
+	if serverConfig == nil {
+		return nil, fmt.Errorf("invalid config of member %s", key)
+	}
+	if serverConfig.Composite() {
+		return nil, fmt.Errorf("member %s is a composite server", key)
+	}
+
+	member := &compositeMember{
+		key:          key,
+		prefix:       prefix,
+		serverConfig: serverConfig,
+		sessions:     make(map[string]Client),
+	}
+
+	// the instances of members not sharing their process are started with the sessions
+	if !serverConfig.ShareProcess {
+		return member, nil
+	}
+
+	if c.shared != nil {
+		if _, err := c.shared(key, serverConfig); err != nil {
+			return nil, fmt.Errorf("failed to connect to member %s: %w", key, err)
+		}
+		return member, nil
+	}
+
+	client, err := NewClient(serverConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to member %s: %w", key, err)
+	}
+	client.OnNotification(c.notify)
+	client.OnRequest(c.request)
+	member.client = client
+
+	return member, nil
+}
+
+// memberClient returns the client of the member for the composite session of the request
+func (c *CompositeClient) memberClient(ctx context.Context, member *compositeMember, method string) (Client, error) {
+	switch {
+	case !member.serverConfig.ShareProcess:
+		return c.sessionClient(member, sessionFromContext(ctx), method)
+	case member.client != nil:
+		return member.client, nil
+	default:
+		return c.shared(member.key, member.serverConfig)
+	}
+}
+
+// sessionClient returns the instance of the member not sharing its process for the composite session,
+// it is started by the initialize request of the session
+func (c *CompositeClient) sessionClient(member *compositeMember, sessionID string, method string) (Client, error) {
+	member.mu.Lock()
+	client := member.sessions[sessionID]
+	member.mu.Unlock()
+
+	if client != nil {
+		return client, nil
+	}
+
+	if method != jsonrpc.MethodInitialize {
+		return nil, fmt.Errorf("member %s is not initialized for the session", member.key)
+	}
+
+	client, err := NewClient(member.serverConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to member %s: %w", member.key, err)
+	}
+	if err := client.Error(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("member %s: %w", member.key, err)
+	}
+
+	// the messages of the instance belong to its session only
+	client.OnNotification(func(_ string, message []byte) {
+		c.notify(sessionID, message)
+	})
+	client.OnRequest(func(_ string, message []byte) ([]byte, error) {
+		return c.request(sessionID, message)
+	})
+
+	member.mu.Lock()
+	previous := member.sessions[sessionID]
+	member.sessions[sessionID] = client
+	member.mu.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+
+	return client, nil
+}
+
+// send sends the message to the member
+func (c *CompositeClient) send(ctx context.Context, member *compositeMember, message []byte) ([]byte, error) {
+	client, err := c.memberClient(ctx, member, gjson.GetBytes(message, "method").String())
+	if err != nil {
+		return nil, err
+	}
+
+	return client.SendMessage(ctx, message)
+}
+
+// owned returns the clients of the members owned by the composite, shared clients are not
+func (c *CompositeClient) owned() []Client {
+	var clients []Client
+	for _, member := range c.members {
+		if member.client != nil {
+			clients = append(clients, member.client)
+		}
+
+		member.mu.Lock()
+		for _, client := range member.sessions {
+			clients = append(clients, client)
+		}
+		member.mu.Unlock()
+	}
+
+	return clients
+}
+
+// memberResponse is the response of a member to a request sent to all members
+type memberResponse struct {
+	member   *compositeMember
+	response []byte
+	err      error
+}
+
+// broadcast sends the message to all members in parallel
+func (c *CompositeClient) broadcast(ctx context.Context, message []byte) []memberResponse {
+	responses := make([]memberResponse, len(c.members))
+
+	var wg sync.WaitGroup
+	for i, member := range c.members {
+		wg.Add(1)
+		go func(i int, member *compositeMember) {
+			defer wg.Done()
+
+			response, err := c.send(ctx, member, message)
+			if err != nil {
+				fmt.Printf("member %s failed: %v\n", member.key, err)
+			}
+			responses[i] = memberResponse{member: member, response: response, err: err}
+		}(i, member)
+	}
+	wg.Wait()
+
+	return responses
+}
+
+// Error returns the first error reported by a member client of the composite
+func (c *CompositeClient) Error() error {
+	for _, member := range c.members {
+		if member.client == nil {
+			continue
+		}
+		if err := member.client.Error(); err != nil {
+			return fmt.Errorf("member %s: %w", member.key, err)
+		}
+	}
+
+	return nil
+}
+
+// Usage returns the resource usage of the exited backends of the members owned by the composite
+func (c *CompositeClient) Usage() []ProcessUsage {
+	var usage []ProcessUsage
+	for _, client := range c.owned() {
+		usage = append(usage, Usage(client)...)
+	}
+
+	return usage
+}
+
+// Stderr returns the last n stderr lines of the backend processes of the members owned by the composite
+func (c *CompositeClient) Stderr(n int) []string {
+	var lines []string
+	for _, client := range c.owned() {
+		lines = append(lines, Stderr(client, 0)...)
+	}
+
+	return tailLines(lines, n)
+}
+
+// Close closes the member clients of the composite, shared clients are left to their server key
+func (c *CompositeClient) Close() error {
+	var errs []error
+	for _, client := range c.owned() {
+		if err := client.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// BindSession returns the client for the session, the members route by the session of the request context
+func (c *CompositeClient) BindSession(sessionID string) Client {
+	return c
+}
+
+// ReleaseSession closes the instances of the members not sharing their process started for the session,
+// and releases the session on the members owned by the composite
+func (c *CompositeClient) ReleaseSession(sessionID string) {
+	for _, member := range c.members {
+		if member.client != nil {
+			ReleaseSession(member.client, sessionID)
+		}
+
+		member.mu.Lock()
+		client := member.sessions[sessionID]
+		delete(member.sessions, sessionID)
+		member.mu.Unlock()
+
+		if client != nil {
+			client.Close()
+		}
+	}
+}
+
+// OnNotification adds a notification handler for the notifications of the member clients of the composite,
+// the notifications of shared clients are routed by their server key
+func (c *CompositeClient) OnNotification(handler NotificationHandler) {
+	c.nmu.Lock()
+	c.notifications = append(c.notifications, handler)
+	c.nmu.Unlock()
+}
+
+// OnRequest sets the handler for requests initiated by the member clients of the composite
+func (c *CompositeClient) OnRequest(handler RequestHandler) {
+	c.nmu.Lock()
+	c.requests = handler
+	c.nmu.Unlock()
+}
+
+// notify sends the notification message to all handlers
+func (c *CompositeClient) notify(sessionID string, message []byte) {
+	c.nmu.RLock()
+	defer c.nmu.RUnlock()
+
+	for _, handler := range c.notifications {
+		handler(sessionID, message)
+	}
+}
+
+// request passes the server request to the handler
+func (c *CompositeClient) request(sessionID string, message []byte) ([]byte, error) {
+	c.nmu.RLock()
+	handler := c.requests
+	c.nmu.RUnlock()
+
+	if handler == nil {
+		return nil, fmt.Errorf("no handler for server request")
+	}
+
+	return handler(sessionID, message)
+}
+
+// SendMessage routes the JSON-RPC message to the members and returns the combined response
+func (c *CompositeClient) SendMessage(ctx context.Context, message []byte) ([]byte, error) {
+	msg := gjson.ParseBytes(message)
+	id := msg.Get("id")
+
+	switch msg.Get("method").String() {
+	case jsonrpc.MethodInitialize:
+		return c.initialize(ctx, message, id)
+	case jsonrpc.MethodPing:
+		return resultResponse(id, map[string]interface{}{}), nil
+	case jsonrpc.MethodListTools:
+		return c.list(ctx, message, id, "tools", false)
+	case jsonrpc.MethodListPrompts:
+		return c.list(ctx, message, id, "prompts", false)
+	case jsonrpc.MethodListResources:
+		return c.list(ctx, message, id, "resources", true)
+	case jsonrpc.MethodListResourceTemplates:
+		return c.list(ctx, message, id, "resourceTemplates", false)
+	case jsonrpc.MethodCallTool, jsonrpc.MethodGetPrompt:
+		return c.routeName(ctx, message, id, "params.name")
+	case jsonrpc.MethodReadResource, jsonrpc.MethodSubscribeResource, jsonrpc.MethodUnsubscribeResource:
+		return c.routeURI(ctx, message, id, msg.Get("params.uri").String())
+	case jsonrpc.MethodComplete:
+		if msg.Get("params.ref.type").String() == "ref/resource" {
+			return c.routeURI(ctx, message, id, msg.Get("params.ref.uri").String())
+		}
+		return c.routeName(ctx, message, id, "params.ref.name")
+	}
+
+	// notifications and other requests, such as logging/setLevel, go to all members
+	responses := c.broadcast(ctx, message)
+	if !id.Exists() {
+		return nil, ctx.Err()
+	}
+
+	return combineResponses(ctx, id, responses)
+}
+
+// combineResponses returns the response to a request sent to all members, the response of a member when
+// they all succeeded and an error naming every member that failed otherwise
+func combineResponses(ctx context.Context, id gjson.Result, responses []memberResponse) ([]byte, error) {
+	var (
+		success  []byte
+		failures []string
+		errs     []error
+		code     int
+	)
+
+	for _, r := range responses {
+		switch {
+		case r.err != nil:
+			errs = append(errs, fmt.Errorf("member %s: %w", r.member.key, r.err))
+			failures = append(failures, fmt.Sprintf("member %s: %v", r.member.key, r.err))
+		case gjson.GetBytes(r.response, "error").Exists():
+			if code == 0 {
+				code = int(gjson.GetBytes(r.response, "error.code").Int())
+			}
+			failures = append(failures, fmt.Sprintf("member %s: %s", r.member.key, gjson.GetBytes(r.response, "error.message").String()))
+		case success == nil:
+			success = r.response
+		}
+	}
+
+	if len(failures) == 0 {
+		return success, nil
+	}
+
+	// the request failed on every member without a response, the errors keep their cause such as a restart
+	if len(errs) == len(responses) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	if code == 0 {
+		code = jsonrpc.ErrorInternalError.Code
+	}
+	message := fmt.Sprintf("%d of %d members failed: %s", len(failures), len(responses), strings.Join(failures, "; "))
+
+	return errorResponse(id, jsonrpc.NewError(code, message, nil)), nil
+}
+
+// initialize initializes all members and merges their capabilities
+func (c *CompositeClient) initialize(ctx context.Context, message []byte, id gjson.Result) ([]byte, error) {
+	var (
+		protocolVersion string
+		capabilities    = map[string]interface{}{}
+		instructions    []string
+		firstErr        error
+	)
+
+	for _, r := range c.broadcast(ctx, message) {
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("member %s: %w", r.member.key, r.err)
+			}
+			continue
+		}
+
+		result := gjson.GetBytes(r.response, "result")
+		if !result.Exists() {
+			fmt.Printf("member %s failed to initialize: %s\n", r.member.key, r.response)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("member %s failed to initialize: %s", r.member.key, gjson.GetBytes(r.response, "error.message").String())
+			}
+			continue
+		}
+
+		// the composite speaks the oldest version of its members
+		if version := result.Get("protocolVersion").String(); protocolVersion == "" || version < protocolVersion {
+			protocolVersion = version
+		}
+
+		mergeCapabilities(capabilities, result.Get("capabilities"))
+
+		if text := result.Get("instructions").String(); text != "" {
+			instructions = append(instructions, fmt.Sprintf("%s (tools prefixed with %s%s): %s", r.member.key, r.member.prefix, c.separator, text))
+		}
+	}
+
+	if protocolVersion == "" {
+		return nil, firstErr
+	}
+
+	name := c.serverConfig.ServerName
+	if name == "" {
+		name = compositeServerName
+	}
+
+	result := map[string]interface{}{
+		"protocolVersion": protocolVersion,
+		"capabilities":    capabilities,
+		"serverInfo": jsonrpc.ServerInfo{
+			Name:    name,
+			Version: compositeServerVersion,
+		},
+	}
+	if len(instructions) > 0 {
+		result["instructions"] = strings.Join(instructions, "\n\n")
+	}
+
+	return resultResponse(id, result), nil
+}
+
+// mergeCapabilities adds the capabilities of a member, a capability or flag is set when a member has it
+func mergeCapabilities(capabilities map[string]interface{}, member gjson.Result) {
+	member.ForEach(func(name, value gjson.Result) bool {
+		merged, ok := capabilities[name.String()].(map[string]interface{})
+		if !ok {
+			merged = map[string]interface{}{}
+			capabilities[name.String()] = merged
+		}
+
+		value.ForEach(func(key, v gjson.Result) bool {
+			if v.Type == gjson.True || merged[key.String()] == nil {
+				merged[key.String()] = v.Value()
+			}
+			return true
+		})
+
+		return true
+	})
+}
+
+// list fans the list request out to all members and returns their items with namespaced names,
+// following the pages of each member. Members failing to list are left out.
+func (c *CompositeClient) list(ctx context.Context, message []byte, id gjson.Result, field string, indexURIs bool) ([]byte, error) {
+	// the composite lists everything in one page
+	message, err := sjson.DeleteBytes(message, "params.cursor")
+	if err != nil {
+		return nil, fmt.Errorf("failed to modify list message: %w", err)
+	}
+
+	items := make([][]json.RawMessage, len(c.members))
+
+	var wg sync.WaitGroup
+	for i, member := range c.members {
+		wg.Add(1)
+		go func(i int, member *compositeMember) {
+			defer wg.Done()
+			items[i] = c.listMember(ctx, member, message, field, indexURIs)
+		}(i, member)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	merged := []json.RawMessage{}
+	for _, memberItems := range items {
+		merged = append(merged, memberItems...)
+	}
+
+	return resultResponse(id, map[string]interface{}{field: merged}), nil
+}
+
+// listMember lists the items of a member, named with the prefix of the member
+func (c *CompositeClient) listMember(ctx context.Context, member *compositeMember, message []byte, field string, indexURIs bool) []json.RawMessage {
+	var items []json.RawMessage
+
+	for page := 0; page < maxListPages; page++ {
+		response, err := c.send(ctx, member, message)
+		if err != nil {
+			fmt.Printf("member %s failed to list %s: %v\n", member.key, field, err)
+			return items
+		}
+
+		result := gjson.GetBytes(response, "result")
+		if !result.Exists() {
+			fmt.Printf("member %s failed to list %s: %s\n", member.key, field, response)
+			return items
+		}
+
+		for _, item := range result.Get(field).Array() {
+			raw, err := sjson.SetBytes([]byte(item.Raw), "name", member.prefix+c.separator+item.Get("name").String())
+			if err != nil {
+				continue
+			}
+			items = append(items, raw)
+
+			if uri := item.Get("uri").String(); indexURIs && uri != "" {
+				c.rmu.Lock()
+				if _, ok := c.resources[uri]; !ok {
+					c.resources[uri] = member
+				}
+				c.rmu.Unlock()
+			}
+		}
+
+		cursor := result.Get("nextCursor").String()
+		if cursor == "" {
+			return items
+		}
+
+		message, err = sjson.SetBytes(message, "params.cursor", cursor)
+		if err != nil {
+			return items
+		}
+	}
+
+	fmt.Printf("member %s has more than %d pages of %s\n", member.key, maxListPages, field)
+	return items
+}
+
+// routeName forwards the message to the member of the namespaced name at path, with the name of the member
+func (c *CompositeClient) routeName(ctx context.Context, message []byte, id gjson.Result, path string) ([]byte, error) {
+	name := gjson.GetBytes(message, path).String()
+
+	prefix, memberName, ok := strings.Cut(name, c.separator)
+	member := c.byPrefix[prefix]
+	if !ok || member == nil {
+		return errorResponse(id, jsonrpc.NewError(jsonrpc.ErrorInvalidParams.Code, fmt.Sprintf("unknown name: %s", name), nil)), nil
+	}
+
+	message, err := sjson.SetBytes(message, path, memberName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to modify message: %w", err)
+	}
+
+	return c.send(ctx, member, message)
+}
+
+// routeURI forwards the message to the member that listed the resource. Resources not listed, such as
+// the ones of resource templates, are asked to the members in order until one has it.
+func (c *CompositeClient) routeURI(ctx context.Context, message []byte, id gjson.Result, uri string) ([]byte, error) {
+	c.rmu.RLock()
+	member := c.resources[uri]
+	c.rmu.RUnlock()
+
+	if member != nil {
+		return c.send(ctx, member, message)
+	}
+
+	var response []byte
+	for _, member := range c.members {
+		res, err := c.send(ctx, member, message)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		response = res
+		if !gjson.GetBytes(res, "error").Exists() {
+			return res, nil
+		}
+	}
+
+	if response != nil {
+		return response, nil
+	}
+
+	return errorResponse(id, jsonrpc.NewError(jsonrpc.ErrorInvalidParams.Code, fmt.Sprintf("unknown resource: %s", uri), nil)), nil
+}
+
+// resultResponse returns the JSON-RPC response with the result for the request id
+func resultResponse(id gjson.Result, result interface{}) []byte {
+	return []byte(jsonrpc.NewResultResponse(result, id.Value()).String())
+}
+
+// errorResponse returns the JSON-RPC error response for the request id
+func errorResponse(id gjson.Result, err *jsonrpc.Error) []byte {
+	return []byte(jsonrpc.NewErrorResponse(err, id.Value()).String())
+}
+
+// ForwardMessage forwards a JSON-RPC message to the members and returns the response
+func (c *CompositeClient) ForwardMessage(ctx context.Context, request *jsonrpc.Request) (*jsonrpc.Response, error) {
+	req, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.SendMessage(ctx, req)
+	if err != nil {
+		fmt.Printf("failed to forward message: %v\n", err)
+		return nil, err
+	}
+
+	// notification message with no response
+	if res == nil {
+		return nil, nil
+	}
+
+	response, err := jsonrpc.UnmarshalResponse(res)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// Initialize initializes the client.
+func (c *CompositeClient) Initialize(ctx context.Context, params *jsonrpc.InitializeParams) (*jsonrpc.InitializeResult, error) {
+	request := jsonrpc.NewRequest(jsonrpc.MethodInitialize, params, 0)
+
+	response, err := c.ForwardMessage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	result := &jsonrpc.InitializeResult{}
+	if err := response.UnmarshalResult(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// NotificationsInitialized sends the initialized notification to the members.
+func (c *CompositeClient) NotificationsInitialized(ctx context.Context) error {
+	request := jsonrpc.NewRequest(jsonrpc.MethodInitializedNotification, nil, nil)
+
+	_, err := c.ForwardMessage(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListTools lists the tools of all members, with namespaced names.
+func (c *CompositeClient) ListTools(ctx context.Context) (*jsonrpc.ListToolsResult, error) {
+	request := jsonrpc.NewRequest(jsonrpc.MethodListTools, nil, 1)
+
+	response, err := c.ForwardMessage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	result := &jsonrpc.ListToolsResult{}
+	if err := response.UnmarshalResult(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CallTool calls the tool with the given namespaced name and arguments.
+func (c *CompositeClient) CallTool(ctx context.Context, params *jsonrpc.CallToolParams) (*jsonrpc.CallToolResult, error) {
+	request := jsonrpc.NewRequest(jsonrpc.MethodCallTool, params, 1)
+
+	response, err := c.ForwardMessage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	result := &jsonrpc.CallToolResult{}
+	if err := response.UnmarshalResult(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,195 @@
+package mcpclient
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+	"github.com/spf13/viper"
+	"github.com/tidwall/gjson"
+)
+
+// fakeMember is a member server answering initialize with its capabilities, recording the tools called
+// and failing logging/setLevel when failing is set
+type fakeMember struct {
+	Client
+	capabilities string
+	failing      bool
+	called       []string
+	mu           sync.Mutex
+}
+
+func (m *fakeMember) SendMessage(ctx context.Context, message []byte) ([]byte, error) {
+	msg := gjson.ParseBytes(message)
+	id := msg.Get("id").Raw
+
+	switch msg.Get("method").String() {
+	case jsonrpc.MethodInitialize:
+		return []byte(`{"jsonrpc":"2.0","id":` + id + `,"result":{"protocolVersion":"2025-03-26","capabilities":` + m.capabilities + `}}`), nil
+	case jsonrpc.MethodCallTool:
+		m.mu.Lock()
+		m.called = append(m.called, msg.Get("params.name").String())
+		m.mu.Unlock()
+		return []byte(`{"jsonrpc":"2.0","id":` + id + `,"result":{"content":[]}}`), nil
+	}
+
+	if m.failing {
+		return []byte(`{"jsonrpc":"2.0","id":` + id + `,"error":{"code":-32601,"message":"Method not found"}}`), nil
+	}
+	return []byte(`{"jsonrpc":"2.0","id":` + id + `,"result":{}}`), nil
+}
+
+// newFakeComposite returns a composite of the alpha and beta fake members
+func newFakeComposite(t *testing.T, prefixes map[string]string, alpha, beta *fakeMember) (*CompositeClient, error) {
+	t.Helper()
+
+	viper.Set("mcp_servers.alpha", map[string]interface{}{"command": "true", "share_process": true})
+	viper.Set("mcp_servers.beta", map[string]interface{}{"command": "true", "share_process": true})
+
+	members := map[string]Client{"alpha": alpha, "beta": beta}
+	return NewCompositeClient(&mcpserver.ServerConfig{
+		ServerType: "composite",
+		Members:    []string{"alpha", "beta"},
+		Prefixes:   prefixes,
+	}, func(key string, _ *mcpserver.ServerConfig) (Client, error) {
+		return members[key], nil
+	})
+}
+
+func TestCompositePrefixes(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefixes map[string]string
+		wantErr  string
+	}{
+		{"member keys", nil, ""},
+		{"custom prefix", map[string]string{"alpha": "a"}, ""},
+		{"prefix collision", map[string]string{"alpha": "x", "beta": "x"}, "is used by another member"},
+		{"prefix colliding with a member key", map[string]string{"alpha": "beta"}, "is used by another member"},
+		{"prefix containing the separator", map[string]string{"alpha": "a__b"}, "contains the separator"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newFakeComposite(t, tt.prefixes, &fakeMember{}, &fakeMember{})
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("NewCompositeClient() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("NewCompositeClient() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCompositeCallToolRouting(t *testing.T) {
+	alpha, beta := &fakeMember{}, &fakeMember{}
+	client, err := newFakeComposite(t, map[string]string{"alpha": "a"}, alpha, beta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		tool      string
+		wantAlpha []string
+		wantBeta  []string
+		wantError bool
+	}{
+		{"custom prefix", "a__search", []string{"search"}, nil, false},
+		{"member key prefix", "beta__fetch", nil, []string{"fetch"}, false},
+		{"name containing the separator", "a__do__it", []string{"do__it"}, nil, false},
+		{"member key of a member with a custom prefix", "alpha__search", nil, nil, true},
+		{"unknown prefix", "zz__search", nil, nil, true},
+		{"no prefix", "search", nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alpha.called, beta.called = nil, nil
+
+			response, err := client.SendMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"`+tt.tool+`"}}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := gjson.GetBytes(response, "error").Exists(); got != tt.wantError {
+				t.Errorf("error response = %v, want %v: %s", got, tt.wantError, response)
+			}
+			if strings.Join(alpha.called, ",") != strings.Join(tt.wantAlpha, ",") || strings.Join(beta.called, ",") != strings.Join(tt.wantBeta, ",") {
+				t.Errorf("called alpha %q and beta %q, want %q and %q", alpha.called, beta.called, tt.wantAlpha, tt.wantBeta)
+			}
+		})
+	}
+}
+
+func TestCompositeInitializeCapabilities(t *testing.T) {
+	alpha := &fakeMember{capabilities: `{"tools":{"listChanged":false},"logging":{}}`}
+	beta := &fakeMember{capabilities: `{"tools":{"listChanged":true},"prompts":{"listChanged":false}}`}
+	client, err := newFakeComposite(t, nil, alpha, beta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := client.SendMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	capabilities := gjson.GetBytes(response, "result.capabilities")
+	if got := capabilities.Get("tools.listChanged").Bool(); !got {
+		t.Errorf("tools.listChanged = %v, want true: %s", got, capabilities)
+	}
+	for _, name := range []string{"logging", "prompts"} {
+		if !capabilities.Get(name).Exists() {
+			t.Errorf("capability %s missing: %s", name, capabilities)
+		}
+	}
+	if got := capabilities.Get("prompts.listChanged"); !got.Exists() || got.Bool() {
+		t.Errorf("prompts.listChanged = %s, want false", got.Raw)
+	}
+}
+
+func TestCompositeBroadcastErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		alphaFails  bool
+		betaFails   bool
+		wantError   bool
+		wantMembers []string // members named in the error
+	}{
+		{"all members succeed", false, false, false, nil},
+		{"one member fails", false, true, true, []string{"1 of 2", "member beta"}},
+		{"every member fails", true, true, true, []string{"2 of 2", "member alpha", "member beta"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := newFakeComposite(t, nil, &fakeMember{failing: tt.alphaFails}, &fakeMember{failing: tt.betaFails})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			response, err := client.SendMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"logging/setLevel","params":{"level":"info"}}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			errorMessage := gjson.GetBytes(response, "error.message")
+			if errorMessage.Exists() != tt.wantError {
+				t.Fatalf("error response = %v, want %v: %s", errorMessage.Exists(), tt.wantError, response)
+			}
+			for _, want := range tt.wantMembers {
+				if !strings.Contains(errorMessage.String(), want) {
+					t.Errorf("error %q does not mention %q", errorMessage, want)
+				}
+			}
+			if tt.wantError && gjson.GetBytes(response, "error.code").Int() != -32601 {
+				t.Errorf("error code = %d, want the code of the members", gjson.GetBytes(response, "error.code").Int())
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package mcpclient
+
+import (
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// rewriteID replaces the client request ID with the upstream ID assigned by the proxy,
+// so that requests of many clients multiplexed over one backend never collide.
+func rewriteID(message []byte, upstreamID int64) ([]byte, error) {
+	message, err := sjson.SetBytes(message, "id", upstreamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewrite request id: %w", err)
+	}
+
+	return message, nil
+}
+
+// restoreID puts the original client request ID back on the response, keeping its JSON type.
+func restoreID(response []byte, id gjson.Result) ([]byte, error) {
+	response, err := sjson.SetRawBytes(response, "id", []byte(id.Raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore response id: %w", err)
+	}
+
+	return response, nil
+}
@@ -0,0 +1,49 @@
+package mcpclient
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestRewriteAndRestoreID(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		upstream int64
+		response string
+		wantID   string
+	}{
+		{"number id", `{"jsonrpc":"2.0","id":1,"method":"ping"}`, 7, `{"jsonrpc":"2.0","id":7,"result":{}}`, `1`},
+		{"string id", `{"jsonrpc":"2.0","id":"1","method":"ping"}`, 8, `{"jsonrpc":"2.0","id":8,"result":{}}`, `"1"`},
+		{"large number id", `{"jsonrpc":"2.0","id":9007199254740993,"method":"ping"}`, 9, `{"jsonrpc":"2.0","id":9,"result":{}}`, `9007199254740993`},
+		{"fractional id", `{"jsonrpc":"2.0","id":1.5,"method":"ping"}`, 10, `{"jsonrpc":"2.0","id":10,"result":{}}`, `1.5`},
+		{"uuid id", `{"jsonrpc":"2.0","id":"6c0e7f5a-3b1e","method":"ping"}`, 11, `{"jsonrpc":"2.0","id":11,"error":{"code":-32601,"message":"not found"}}`, `"6c0e7f5a-3b1e"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rewritten, err := rewriteID([]byte(tt.message), tt.upstream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := gjson.GetBytes(rewritten, "id").Int(); got != tt.upstream {
+				t.Errorf("rewriteID() id = %d, want %d", got, tt.upstream)
+			}
+			if got, want := gjson.GetBytes(rewritten, "method").String(), gjson.Get(tt.message, "method").String(); got != want {
+				t.Errorf("rewriteID() method = %q, want %q", got, want)
+			}
+
+			restored, err := restoreID([]byte(tt.response), gjson.Get(tt.message, "id"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := gjson.GetBytes(restored, "id").Raw; got != tt.wantID {
+				t.Errorf("restoreID() id = %s, want %s", got, tt.wantID)
+			}
+			if got, want := gjson.GetBytes(restored, "result").Raw+gjson.GetBytes(restored, "error").Raw, gjson.Get(tt.response, "result").Raw+gjson.Get(tt.response, "error").Raw; got != want {
+				t.Errorf("restoreID() body = %s, want %s", got, want)
+			}
+		})
+	}
+}
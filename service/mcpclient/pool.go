@@ -0,0 +1,645 @@
+package mcpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	PoolStrategyLeastBusy  = "least_busy"
+	PoolStrategyRoundRobin = "round_robin"
+
+	defaultScaleUpThreshold = 4
+	defaultScaleDownIdle    = 300 // seconds
+)
+
+// errPoolFull is returned by scaleUp when the pool has no room for a new instance
+var errPoolFull = errors.New("pool is full")
+
+// PoolClient is a client that spreads requests over a pool of stdio backend processes.
+type PoolClient struct {
+	*pool
+	sessionID string // pinned session, empty when not bound
+}
+
+// pool is the state shared by a PoolClient and its session bound views.
+type pool struct {
+	serverConfig    *mcpserver.ServerConfig
+	instances       []*poolInstance
+	closedInstances []*poolInstance          // instances closed with the pool, for their usage
+	sessions        map[string]*poolInstance // pinned sessions
+	next            uint64                   // round robin cursor
+	starting        int                      // instances being started outside mu
+	started         chan struct{}            // closed and replaced when an instance is done starting
+	mu              sync.Mutex
+	initRequest     []byte                // recorded initialize request, replayed on new instances
+	initialized     []byte                // recorded initialized notification
+	notifications   []NotificationHandler // notification handlers
+	requests        RequestHandler        // server request handler
+	nmu             sync.RWMutex
+	done            chan struct{} // pool closed signal
+	closeOnce       sync.Once
+}
+
+// poolInstance is one supervised backend process of the pool, restarted when it exits.
+type poolInstance struct {
+	client   *SupervisedClient
+	inflight atomic.Int64 // in-flight requests
+	lastUsed atomic.Int64
+	ready    atomic.Bool // set once the instance answered initialize, notifications are only sent to ready instances
+	mu       sync.Mutex  // serializes the initialize replay
+}
+
+// NewPoolClient creates a new PoolClient and starts its minimum instances.
+func NewPoolClient(serverConfig *mcpserver.ServerConfig) (*PoolClient, error) {
+	p := &pool{
+		serverConfig: serverConfig,
+		sessions:     make(map[string]*poolInstance),
+		started:      make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	minInstances := max(serverConfig.MinInstances, 1)
+	for i := 0; i < minInstances; i++ {
+		instance, err := p.spawn()
+		if err != nil {
+			p.close()
+			return nil, err
+		}
+		p.instances = append(p.instances, instance)
+	}
+
+	go p.scaleDown()
+
+	fmt.Printf("mcp server pool running with %d instances, max %d\n", minInstances, serverConfig.MaxInstances)
+
+	return &PoolClient{pool: p}, nil
+}
+
+// spawn starts a new instance, it is added to the pool by the caller
+func (p *pool) spawn() (*poolInstance, error) {
+	client, err := NewSupervisedClient(p.serverConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	client.OnNotification(p.notify)
+	client.OnRequest(p.request)
+
+	instance := &poolInstance{client: client}
+	instance.lastUsed.Store(time.Now().Unix())
+
+	return instance, nil
+}
+
+// acquire picks an instance for the request, scaling up when all instances are busy.
+// New instances are started without holding p.mu, so that the running instances keep serving requests.
+func (p *pool) acquire(sessionID string) (*poolInstance, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	threshold := int64(p.serverConfig.ScaleUpThreshold)
+	if threshold <= 0 {
+		threshold = defaultScaleUpThreshold
+	}
+
+	for {
+		if p.isClosed() {
+			return nil, fmt.Errorf("pool closed")
+		}
+
+		p.removeClosed()
+
+		if instance, ok := p.sessions[sessionID]; ok && sessionID != "" {
+			instance.inflight.Add(1)
+			return instance, nil
+		}
+
+		instance := p.pick()
+
+		if instance == nil || instance.inflight.Load() >= threshold {
+			spawned, err := p.scaleUp()
+			switch {
+			case spawned != nil:
+				instance = spawned
+			case instance == nil && errors.Is(err, errPoolFull) && p.starting > 0:
+				// every instance is starting, the request waits for one of them
+				p.waitStarted()
+				continue
+			case instance == nil:
+				return nil, err
+			case !p.running(instance):
+				// the picked instance was closed while p.mu was released
+				continue
+			}
+		}
+
+		// the session may have been pinned while an instance was starting
+		if pinned, ok := p.sessions[sessionID]; ok && sessionID != "" {
+			instance = pinned
+		} else if sessionID != "" {
+			p.sessions[sessionID] = instance
+		}
+
+		instance.inflight.Add(1)
+
+		return instance, nil
+	}
+}
+
+// running reports whether the instance is still in the pool and running, the caller holds p.mu
+func (p *pool) running(instance *poolInstance) bool {
+	return slices.Contains(p.instances, instance) && !instance.client.closed()
+}
+
+// waitStarted waits for an instance being started to be done or for the pool to close.
+// The caller holds p.mu, it is released while waiting.
+func (p *pool) waitStarted() {
+	started := p.started
+	p.mu.Unlock()
+	select {
+	case <-started:
+	case <-p.done:
+	}
+	p.mu.Lock()
+}
+
+// scaleUp starts a new instance when the pool has room for it and adds it to the pool, it returns errPoolFull
+// when the pool is full. The caller holds p.mu, it is released while the instance starts.
+func (p *pool) scaleUp() (*poolInstance, error) {
+	if len(p.instances)+p.starting >= max(p.serverConfig.MaxInstances, 1) {
+		return nil, fmt.Errorf("%w with %d instances", errPoolFull, len(p.instances)+p.starting)
+	}
+
+	p.starting++
+	p.mu.Unlock()
+	instance, err := p.spawn()
+	p.mu.Lock()
+	p.starting--
+
+	// wake up the requests waiting for a starting instance
+	close(p.started)
+	p.started = make(chan struct{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.isClosed() {
+		instance.client.Close()
+		return nil, fmt.Errorf("pool closed")
+	}
+
+	p.instances = append(p.instances, instance)
+
+	return instance, nil
+}
+
+// isClosed reports whether the pool is closed
+func (p *pool) isClosed() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// pick chooses an instance with the configured strategy
+func (p *pool) pick() *poolInstance {
+	if len(p.instances) == 0 {
+		return nil
+	}
+
+	if p.serverConfig.PoolStrategy == PoolStrategyRoundRobin {
+		instance := p.instances[p.next%uint64(len(p.instances))]
+		p.next++
+		return instance
+	}
+
+	// least busy by default
+	picked := p.instances[0]
+	for _, instance := range p.instances[1:] {
+		if instance.inflight.Load() < picked.inflight.Load() {
+			picked = instance
+		}
+	}
+
+	return picked
+}
+
+// release marks the end of a request on the instance
+func (p *pool) release(instance *poolInstance) {
+	instance.inflight.Add(-1)
+	instance.lastUsed.Store(time.Now().Unix())
+}
+
+// removeClosed drops the instances whose supervisor gave up and their pinned sessions, the caller must hold p.mu
+func (p *pool) removeClosed() {
+	instances := p.instances[:0]
+	for _, instance := range p.instances {
+		if instance.client.closed() {
+			for sessionID, pinned := range p.sessions {
+				if pinned == instance {
+					delete(p.sessions, sessionID)
+				}
+			}
+			continue
+		}
+		instances = append(instances, instance)
+	}
+	p.instances = instances
+}
+
+// scaleDown closes instances above the minimum that sit idle
+func (p *pool) scaleDown() {
+	idle := p.serverConfig.ScaleDownIdle
+	if idle <= 0 {
+		idle = defaultScaleDownIdle
+	}
+
+	ticker := time.NewTicker(time.Duration(idle) * time.Second / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		p.removeClosed()
+
+		pinned := make(map[*poolInstance]bool)
+		for _, instance := range p.sessions {
+			pinned[instance] = true
+		}
+
+		minInstances := max(p.serverConfig.MinInstances, 1)
+		deadline := time.Now().Add(-time.Duration(idle) * time.Second).Unix()
+
+		var idles []*poolInstance
+		instances := p.instances[:0]
+		for _, instance := range p.instances {
+			if len(p.instances)-len(idles) > minInstances && !pinned[instance] &&
+				instance.inflight.Load() == 0 && instance.lastUsed.Load() < deadline {
+				idles = append(idles, instance)
+				continue
+			}
+			instances = append(instances, instance)
+		}
+		p.instances = instances
+		p.mu.Unlock()
+
+		for _, instance := range idles {
+			fmt.Printf("pool scale down idle instance of %s\n", p.serverConfig.ServerKey)
+			instance.client.Close()
+		}
+	}
+}
+
+// prepare replays the recorded initialize handshake on instances that have not seen it, an initialize
+// request goes to the backend as it is and the instance is ready once it is answered
+func (p *pool) prepare(instance *poolInstance, method string) error {
+	instance.mu.Lock()
+	defer instance.mu.Unlock()
+
+	if instance.ready.Load() || method == jsonrpc.MethodInitialize {
+		return nil
+	}
+
+	p.mu.Lock()
+	initRequest := p.initRequest
+	p.mu.Unlock()
+
+	if initRequest == nil {
+		return nil
+	}
+
+	response, err := instance.client.SendMessage(context.Background(), initRequest)
+	if err != nil {
+		return fmt.Errorf("failed to replay initialize: %w", err)
+	}
+	if !gjson.GetBytes(response, "result").Exists() {
+		return fmt.Errorf("failed to replay initialize: %s", response)
+	}
+
+	// the initialized notification is sent here unless it comes after the instance is ready,
+	// then it is sent to the instance with the other ready instances
+	initialized := p.ready(instance, nil)
+	if initialized != nil {
+		if _, err := instance.client.SendMessage(context.Background(), initialized); err != nil {
+			return fmt.Errorf("failed to replay initialized notification: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ready marks the instance ready, recording the initialize request it answered when not nil,
+// and returns the recorded initialized notification
+func (p *pool) ready(instance *poolInstance, initRequest []byte) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if initRequest != nil {
+		p.initRequest = initRequest
+	}
+	instance.ready.Store(true)
+
+	return p.initialized
+}
+
+// readyInstances records the notification when it is the initialized notification and returns the ready instances
+func (p *pool) readyInstances(message []byte, method string) []*poolInstance {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if method == jsonrpc.MethodInitializedNotification {
+		p.initialized = message
+	}
+
+	var instances []*poolInstance
+	for _, instance := range p.instances {
+		if instance.ready.Load() {
+			instances = append(instances, instance)
+		}
+	}
+
+	return instances
+}
+
+// notify sends the notification message to all handlers
+func (p *pool) notify(sessionID string, message []byte) {
+	p.nmu.RLock()
+	defer p.nmu.RUnlock()
+
+	for _, handler := range p.notifications {
+		handler(sessionID, message)
+	}
+}
+
+// request passes the server request to the handler
+func (p *pool) request(sessionID string, message []byte) ([]byte, error) {
+	p.nmu.RLock()
+	handler := p.requests
+	p.nmu.RUnlock()
+
+	if handler == nil {
+		return nil, fmt.Errorf("no handler for server request")
+	}
+
+	return handler(sessionID, message)
+}
+
+// close closes all instances
+func (p *pool) close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+
+	p.mu.Lock()
+	instances := p.instances
+	p.instances = nil
+	p.closedInstances = instances
+	p.sessions = make(map[string]*poolInstance)
+	p.mu.Unlock()
+
+	var err error
+	for _, instance := range instances {
+		if cerr := instance.client.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// BindSession returns a view of the pool that keeps the session on one instance when the server is stateful
+func (c *PoolClient) BindSession(sessionID string) Client {
+	if !c.serverConfig.Stateful || sessionID == "" {
+		return c
+	}
+
+	return &PoolClient{pool: c.pool, sessionID: sessionID}
+}
+
+// ReleaseSession unpins the session from its instance
+func (c *PoolClient) ReleaseSession(sessionID string) {
+	c.mu.Lock()
+	delete(c.sessions, sessionID)
+	c.mu.Unlock()
+}
+
+// Error returns the first error reported by an instance
+func (c *PoolClient) Error() error {
+	c.mu.Lock()
+	instances := append([]*poolInstance(nil), c.instances...)
+	c.mu.Unlock()
+
+	for _, instance := range instances {
+		if err := instance.client.Error(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Usage returns the resource usage of the exited instances of the pool, once the pool is closed
+// they are the instances closed with it
+func (c *PoolClient) Usage() []ProcessUsage {
+	c.mu.Lock()
+	instances := append(append([]*poolInstance(nil), c.instances...), c.closedInstances...)
+	c.mu.Unlock()
+
+	var usage []ProcessUsage
+	for _, instance := range instances {
+		usage = append(usage, instance.client.Usage()...)
+	}
+
+	return usage
+}
+
+// Stderr returns the last n stderr lines of the running instances, in the order of the instances
+func (c *PoolClient) Stderr(n int) []string {
+	c.mu.Lock()
+	instances := append([]*poolInstance(nil), c.instances...)
+	c.mu.Unlock()
+
+	var lines []string
+	for _, instance := range instances {
+		lines = append(lines, instance.client.Stderr(0)...)
+	}
+
+	return tailLines(lines, n)
+}
+
+// Close closes every instance of the pool
+func (c *PoolClient) Close() error {
+	return c.close()
+}
+
+// OnNotification adds a notification handler
+func (c *PoolClient) OnNotification(handler NotificationHandler) {
+	c.nmu.Lock()
+	c.notifications = append(c.notifications, handler)
+	c.nmu.Unlock()
+}
+
+// OnRequest sets the handler for requests initiated by the server
+func (c *PoolClient) OnRequest(handler RequestHandler) {
+	c.nmu.Lock()
+	c.requests = handler
+	c.nmu.Unlock()
+}
+
+// SendMessage sends a JSON-RPC message to an instance of the pool and returns the response
+func (c *PoolClient) SendMessage(ctx context.Context, message []byte) ([]byte, error) {
+	msg := gjson.ParseBytes(message)
+	method := msg.Get("method").String()
+
+	if !msg.Get("id").Exists() {
+		// notification message, delivered to every ready instance, the others get the handshake on their first request
+		for _, instance := range c.readyInstances(message, method) {
+			if _, err := instance.client.SendMessage(ctx, message); err != nil {
+				fmt.Printf("pool failed to send notification: %v\n", err)
+			}
+		}
+
+		return nil, nil
+	}
+
+	instance, err := c.acquire(c.sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer c.release(instance)
+
+	if err := c.prepare(instance, method); err != nil {
+		return nil, err
+	}
+
+	response, err := instance.client.SendMessage(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+
+	if method == jsonrpc.MethodInitialize && gjson.GetBytes(response, "result").Exists() {
+		c.ready(instance, message)
+	}
+
+	return response, nil
+}
+
+// ForwardMessage forwards a JSON-RPC message to the MCP server and returns the response
+func (c *PoolClient) ForwardMessage(ctx context.Context, request *jsonrpc.Request) (*jsonrpc.Response, error) {
+	req, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.SendMessage(ctx, req)
+	if err != nil {
+		fmt.Printf("failed to forward message: %v\n", err)
+		return nil, err
+	}
+
+	// notification message with no response
+	if res == nil {
+		return nil, nil
+	}
+
+	response, err := jsonrpc.UnmarshalResponse(res)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// Initialize initializes the client.
+func (c *PoolClient) Initialize(ctx context.Context, params *jsonrpc.InitializeParams) (*jsonrpc.InitializeResult, error) {
+	request := jsonrpc.NewRequest(jsonrpc.MethodInitialize, params, 0)
+
+	response, err := c.ForwardMessage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	result := &jsonrpc.InitializeResult{}
+	if err := response.UnmarshalResult(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// NotificationsInitialized sends the initialized notification to the server.
+func (c *PoolClient) NotificationsInitialized(ctx context.Context) error {
+	request := jsonrpc.NewRequest(jsonrpc.MethodInitializedNotification, nil, nil)
+
+	_, err := c.ForwardMessage(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListTools lists the tools available in the MCP server.
+func (c *PoolClient) ListTools(ctx context.Context) (*jsonrpc.ListToolsResult, error) {
+	request := jsonrpc.NewRequest(jsonrpc.MethodListTools, nil, 1)
+
+	response, err := c.ForwardMessage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	result := &jsonrpc.ListToolsResult{}
+	if err := response.UnmarshalResult(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CallTool calls a tool with the given name and arguments.
+func (c *PoolClient) CallTool(ctx context.Context, params *jsonrpc.CallToolParams) (*jsonrpc.CallToolResult, error) {
+	request := jsonrpc.NewRequest(jsonrpc.MethodCallTool, params, 1)
+
+	response, err := c.ForwardMessage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	result := &jsonrpc.CallToolResult{}
+	if err := response.UnmarshalResult(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,85 @@
+package mcpclient
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+)
+
+// echoServer answers every request with an initialize result and logs the notifications it receives
+// to a file of the process in dir
+const echoServer = `while IFS= read -r line; do
+  case "$line" in
+    *'"id":'*)
+      id=$(printf '%s' "$line" | sed 's/.*"id":\([^,}]*\).*/\1/')
+      printf '{"jsonrpc":"2.0","id":%s,"result":{"protocolVersion":"2025-03-26"}}\n' "$id" ;;
+    *) printf '%s\n' "$line" >> "$0.$$" ;;
+  esac
+done`
+
+func TestPoolNotifiesReadyInstances(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the echo server is a shell script")
+	}
+
+	log := filepath.Join(t.TempDir(), "notifications")
+	client, err := NewPoolClient(&mcpserver.ServerConfig{
+		ServerKey:    "pool",
+		Command:      "sh",
+		Args:         []string{"-c", echoServer, log},
+		MinInstances: 2,
+		MaxInstances: 2,
+		PoolStrategy: PoolStrategyRoundRobin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	send := func(message string) {
+		if _, err := client.SendMessage(ctx, []byte(message)); err != nil {
+			t.Fatalf("SendMessage(%s) error = %v", message, err)
+		}
+	}
+
+	// the initialize goes to the first instance, the second one is not ready yet
+	send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+	if ready := []bool{client.instances[0].ready.Load(), client.instances[1].ready.Load()}; !ready[0] || ready[1] {
+		t.Fatalf("ready = %v, want only the first instance", ready)
+	}
+
+	send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	// the second instance gets the handshake replayed on its first request
+	send(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	if !client.instances[1].ready.Load() {
+		t.Fatal("second instance not ready after the replay")
+	}
+
+	// the notifications are written once the backends read them, a request after them is answered in order
+	send(`{"jsonrpc":"2.0","id":3,"method":"ping"}`)
+	send(`{"jsonrpc":"2.0","id":4,"method":"ping"}`)
+
+	files, err := filepath.Glob(log + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("%d instances got notifications, want 2", len(files))
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(string(data), "notifications/initialized"); n != 1 {
+			t.Errorf("instance got %d initialized notifications, want 1: %s", n, data)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package mcpclient
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+)
+
+// processes are the backend processes started by the stdio clients and not waited for yet
+var processes sync.Map // *exec.Cmd -> struct{}
+
+// trackProcess records a started backend process until it exits
+func trackProcess(cmd *exec.Cmd) {
+	processes.Store(cmd, struct{}{})
+}
+
+// untrackProcess forgets a backend process that has exited
+func untrackProcess(cmd *exec.Cmd) {
+	processes.Delete(cmd)
+}
+
+// KillProcesses kills the process groups of the backend processes still running,
+// so that no child of a shell command outlives the proxy
+func KillProcesses() {
+	processes.Range(func(key, _ any) bool {
+		cmd := key.(*exec.Cmd)
+		if err := killProcessGroup(cmd); err != nil {
+			fmt.Printf("failed to kill process group of %d: %v\n", cmd.Process.Pid, err)
+		}
+		processes.Delete(cmd)
+		return true
+	})
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+
+package mcpclient
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// cpuLimitSignal is the signal a process gets when it reaches its cpu limit
+const cpuLimitSignal = syscall.SIGXCPU
+
+// setProcessGroup starts the command in its own process group, the children of the shell are then killed with it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills the process group of the command
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+		return err
+	}
+
+	return nil
+}
+
+// maxRSS returns the maximum resident set size of the exited process in KB
+func maxRSS(state *os.ProcessState) int64 {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+
+	// darwin reports bytes
+	if runtime.GOOS == "darwin" {
+		return int64(rusage.Maxrss) / 1024
+	}
+
+	return int64(rusage.Maxrss)
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+package mcpclient
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// cpuLimitSignal is never received on windows, processes have no cpu limit there
+const cpuLimitSignal = syscall.Signal(-1)
+
+// setProcessGroup is a no-op on windows, the process tree is killed with taskkill
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the process tree of the command
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
+
+// maxRSS is not reported on windows
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
@@ -0,0 +1,49 @@
+package mcpclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+	"github.com/tidwall/gjson"
+)
+
+// RequestHandler handles a request initiated by the backend server, such as sampling/createMessage,
+// roots/list or elicitation/create, and returns the response of the downstream client. sessionID is the
+// downstream session whose request the server request comes with, empty when it cannot be tied to one.
+// A *jsonrpc.Error returned by the handler is sent back to the backend as is.
+type RequestHandler func(sessionID string, message []byte) ([]byte, error)
+
+// handleServerRequest runs the handler for a server request and returns the response for the backend,
+// carrying the ID the backend assigned to the request.
+func handleServerRequest(handler RequestHandler, sessionID string, message []byte) ([]byte, error) {
+	id := gjson.GetBytes(message, "id")
+
+	var response []byte
+	var err error
+
+	if handler == nil {
+		response, err = json.Marshal(jsonrpc.NewErrorResponse(jsonrpc.ErrorMethodNotFound, nil))
+	} else if response, err = handler(sessionID, message); err != nil {
+		fmt.Printf("failed to handle server request: %v\n", err)
+
+		var jerr *jsonrpc.Error
+		if !errors.As(err, &jerr) {
+			jerr = jsonrpc.NewError(jsonrpc.ErrorInternalError.Code, err.Error(), nil)
+		}
+		response, err = json.Marshal(jsonrpc.NewErrorResponse(jerr, nil))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return restoreID(response, id)
+}
+
+// cancelNotification builds the cancelled notification of the upstream request id.
+func cancelNotification(id int64, reason error) []byte {
+	message, _ := json.Marshal(jsonrpc.NewCancelledNotification(id, reason.Error()))
+	return message
+}
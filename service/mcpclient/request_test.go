@@ -0,0 +1,49 @@
+package mcpclient
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+	"github.com/tidwall/gjson"
+)
+
+func TestHandleServerRequest(t *testing.T) {
+	rejected := jsonrpc.NewError(-32600, "rejected", nil)
+
+	tests := []struct {
+		name      string
+		handler   RequestHandler
+		sessionID string
+		wantID    string
+		wantCode  int64
+		wantText  string
+	}{
+		{"no handler", nil, "s", `"srv-1"`, -32601, ""},
+		{"answered", func(sessionID string, _ []byte) ([]byte, error) {
+			return []byte(`{"jsonrpc":"2.0","id":"mcprouter-1","result":{"text":"` + sessionID + `"}}`), nil
+		}, "s", `"srv-1"`, 0, "s"},
+		{"jsonrpc error", func(string, []byte) ([]byte, error) { return nil, rejected }, "", `"srv-1"`, -32600, ""},
+		{"other error", func(string, []byte) ([]byte, error) { return nil, errors.New("boom") }, "s", `"srv-1"`, -32603, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := handleServerRequest(tt.handler, tt.sessionID, []byte(`{"jsonrpc":"2.0","id":"srv-1","method":"roots/list"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res := gjson.ParseBytes(response)
+			if got := res.Get("id").Raw; got != tt.wantID {
+				t.Errorf("id = %s, want %s", got, tt.wantID)
+			}
+			if got := res.Get("error.code").Int(); got != tt.wantCode {
+				t.Errorf("error code = %d, want %d", got, tt.wantCode)
+			}
+			if got := res.Get("result.text").String(); got != tt.wantText {
+				t.Errorf("result text = %q, want %q", got, tt.wantText)
+			}
+		})
+	}
+}
@@ -2,12 +2,14 @@ package mcpclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chatmcp/mcprouter/service/jsonrpc"
@@ -16,26 +18,49 @@ import (
 	"github.com/tidwall/sjson"
 )
 
+const (
+	headerMcpSessionID       = "Mcp-Session-Id"
+	headerMcpProtocolVersion = "MCP-Protocol-Version"
+)
+
 // RestClient is a client that uses HTTP to communicate with the backend mcp server.
 type RestClient struct {
 	serverConfig  *mcpserver.ServerConfig
-	httpClient    *http.Client
-	done          chan struct{}         // client closed signal
-	messages      map[int64]chan []byte // response messages channel
-	mu            sync.RWMutex
-	notifications []func(message []byte) // notification handlers
+	httpClient    *http.Client    // client of messages with no response
+	streamClient  *http.Client    // client of requests, bounded by the request timeout
+	ctx           context.Context // done when the client is closed, its requests are cancelled with it
+	stop          context.CancelFunc
+	notifications []NotificationHandler // notification handlers
+	requests      RequestHandler        // server request handler
 	nmu           sync.RWMutex
-	err           chan error // error channel
+	nextID        atomic.Int64  // upstream request id sequence
+	routes        requestRoutes // sessions of the requests in flight
+	err           chan error    // error channel
+
+	// sessions of the backend by downstream session, assigned on the initialize of the downstream session
+	// and sent with its messages
+	sessions map[string]upstreamSession
+	smu      sync.RWMutex
+}
+
+// upstreamSession is the session the backend assigned to the initialize of a downstream session
+type upstreamSession struct {
+	id              string
+	protocolVersion string
 }
 
 // NewRestClient creates a new RestClient.
 func NewRestClient(serverConfig *mcpserver.ServerConfig) (*RestClient, error) {
+	ctx, stop := context.WithCancel(context.Background())
+
 	client := &RestClient{
 		serverConfig: serverConfig,
-		httpClient:   &http.Client{Timeout: 30 * time.Second},
-		done:         make(chan struct{}),
-		messages:     make(map[int64]chan []byte),
+		httpClient:   &http.Client{Timeout: defaultTimeout},
+		streamClient: &http.Client{},
+		ctx:          ctx,
+		stop:         stop,
 		err:          make(chan error, 1),
+		sessions:     make(map[string]upstreamSession),
 	}
 
 	fmt.Printf("mcp server connecting to: %s\n", serverConfig.ServerURL)
@@ -53,33 +78,29 @@ func (c *RestClient) Error() error {
 	}
 }
 
-// Close client
+// Close client, the requests in flight are cancelled
 func (c *RestClient) Close() error {
-	c.mu.Lock()
-	select {
-	case <-c.done:
-		c.mu.Unlock()
-		return nil
-	default:
-		close(c.done)
-		c.mu.Unlock()
-	}
-
-	// cancel any pending requests by setting a short timeout
-	c.httpClient.Timeout = 100 * time.Millisecond
+	c.stop()
 
 	return nil
 }
 
 // OnNotification adds a notification handler
-func (c *RestClient) OnNotification(handler func(message []byte)) {
+func (c *RestClient) OnNotification(handler NotificationHandler) {
 	c.nmu.Lock()
 	c.notifications = append(c.notifications, handler)
 	c.nmu.Unlock()
 }
 
+// OnRequest sets the handler for requests initiated by the server
+func (c *RestClient) OnRequest(handler RequestHandler) {
+	c.nmu.Lock()
+	c.requests = handler
+	c.nmu.Unlock()
+}
+
 // SendMessage sends a JSON-RPC message to the MCP server and returns the response
-func (c *RestClient) SendMessage(message []byte) ([]byte, error) {
+func (c *RestClient) SendMessage(ctx context.Context, message []byte) ([]byte, error) {
 	fmt.Printf("sending message: %s\n", message)
 
 	// parsed message
@@ -101,7 +122,8 @@ func (c *RestClient) SendMessage(message []byte) ([]byte, error) {
 
 	var err error
 
-	message, err = sjson.SetBytes(message, "params._meta", metadata)
+	// keep the client _meta, such as progressToken, and add the auth params
+	message, err = sjson.SetBytes(message, "params._meta.auth", serverParams)
 	if err != nil {
 		return nil, fmt.Errorf("failed to modify message: %w", err)
 	}
@@ -115,97 +137,279 @@ func (c *RestClient) SendMessage(message []byte) ([]byte, error) {
 
 	if !msg.Get("id").Exists() {
 		// notification message
-		req, err := http.NewRequest("POST", c.serverConfig.ServerURL, bytes.NewReader(message))
-		if err != nil {
-			return nil, fmt.Errorf("failed to create request: %w", err)
-		}
-
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err := c.httpClient.Do(req)
-		if err != nil {
+		if err := c.post(message, sessionFromContext(ctx)); err != nil {
 			return nil, fmt.Errorf("failed to send notification: %w", err)
 		}
-		defer resp.Body.Close()
 
 		fmt.Printf("sent notification message: %s\n", message)
 
 		return nil, nil
 	}
 
-	// not notification message
-	id := msg.Get("id").Int()
+	// not notification message, assign an upstream id unique to this backend
+	id := c.nextID.Add(1)
+
+	message, err = rewriteID(message, id)
+	if err != nil {
+		return nil, err
+	}
 
-	// message channel
-	msgch := make(chan []byte, 1)
+	message, err = c.routes.add(ctx, id, message)
+	if err != nil {
+		return nil, err
+	}
+	defer c.routes.remove(id)
 
-	c.mu.Lock()
-	c.messages[id] = msgch
-	c.mu.Unlock()
+	// a timeout fails the request only, the backend keeps running
+	timeout := requestTimeout(c.serverConfig, msg)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	defer func() {
-		c.mu.Lock()
-		delete(c.messages, id)
-		c.mu.Unlock()
-	}()
+	// closing the client cancels the request
+	defer context.AfterFunc(c.ctx, cancel)()
 
-	req, err := http.NewRequest("POST", c.serverConfig.ServerURL, bytes.NewReader(message))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.serverConfig.ServerURL, bytes.NewReader(message))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json, text/event-stream")
+	// initialize starts a new session of the backend for the downstream session
+	c.setHeaders(req, sessionFromContext(ctx), msg.Get("method").String() != "initialize")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.streamClient.Do(req)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, c.abort(ctx, id, timeout)
+		}
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	// Check response type by Content-Type header
+	contentType := resp.Header.Get("Content-Type")
+	if resp.StatusCode == http.StatusOK && strings.Contains(contentType, "text/event-stream") {
+		// Relay the SSE stream until the response arrives
+		response, err := c.readStream(resp.Body, id, sessionFromContext(ctx))
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, c.abort(ctx, id, timeout)
+			}
+			return nil, err
+		}
+
+		if msg.Get("method").String() == "initialize" {
+			c.saveSession(sessionFromContext(ctx), resp.Header, response)
+		}
+
+		return restoreID(response, msg.Get("id"))
+	}
+
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, c.abort(ctx, id, timeout)
+		}
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	// Add debug information
-	fmt.Printf("HTTP Status: %d\n", resp.StatusCode)
-	fmt.Printf("Content-Type: %s\n", resp.Header.Get("Content-Type"))
-	fmt.Printf("Response Body: %s\n", string(responseBody))
-
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("server returned status code %d: %s", resp.StatusCode, responseBody)
 	}
 
-	// Check response type by Content-Type header
-	contentType := resp.Header.Get("Content-Type")
-	if strings.Contains(contentType, "text/event-stream") {
-		// Parse SSE format and extract data field
-		responseStr := string(responseBody)
-		lines := strings.Split(responseStr, "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if strings.HasPrefix(line, "data: ") {
-				// Extract content from data field
-				dataContent := strings.TrimPrefix(line, "data: ")
-				return []byte(dataContent), nil
+	if msg.Get("method").String() == "initialize" {
+		c.saveSession(sessionFromContext(ctx), resp.Header, responseBody)
+	}
+
+	return restoreID(responseBody, msg.Get("id"))
+}
+
+// readStream reads the SSE stream of a response, relaying notifications and server requests
+// as they arrive, and returns once the response for the request id is received.
+// The messages of the stream are about the request, they belong to its session.
+func (c *RestClient) readStream(body io.Reader, id int64, sessionID string) ([]byte, error) {
+	var response []byte
+
+	err := readEvents(body, func(_ string, data []byte) bool {
+		response = c.dispatch(data, id, sessionID)
+		return response != nil
+	})
+
+	if err == io.EOF {
+		return nil, fmt.Errorf("stream closed with no response")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	return response, nil
+}
+
+// dispatch handles a message received on the stream of a request of the session,
+// it returns the message when it is the response for the request id
+func (c *RestClient) dispatch(message []byte, id int64, sessionID string) []byte {
+	msg := gjson.ParseBytes(message)
+	if msg.Get("jsonrpc").String() != jsonrpc.JSONRPC_VERSION {
+		fmt.Printf("invalid stream message: %s\n", message)
+		return nil
+	}
+
+	// notification message
+	if !msg.Get("id").Exists() {
+		_, message := c.routes.notification(message)
+
+		c.nmu.RLock()
+		for _, handler := range c.notifications {
+			handler(sessionID, message)
+		}
+		c.nmu.RUnlock()
+		return nil
+	}
+
+	// request message initiated by the server, answered with a new POST
+	if msg.Get("method").Exists() {
+		c.nmu.RLock()
+		handler := c.requests
+		c.nmu.RUnlock()
+
+		go func() {
+			response, err := handleServerRequest(handler, sessionID, message)
+			if err != nil {
+				fmt.Printf("failed to build server request response: %v\n", err)
+				return
+			}
+
+			if err := c.post(response, sessionID); err != nil {
+				fmt.Printf("failed to send server request response: %v\n", err)
 			}
+		}()
+		return nil
+	}
+
+	if msg.Get("id").Int() != id {
+		fmt.Printf("isolated response message: %s\n", message)
+		return nil
+	}
+
+	return message
+}
+
+// abort returns the error of a request aborted by its context, the server is told to stop working on it
+// unless the client is closed
+func (c *RestClient) abort(ctx context.Context, id int64, timeout time.Duration) error {
+	if c.ctx.Err() != nil {
+		return fmt.Errorf("client closed")
+	}
+
+	c.cancel(sessionFromContext(ctx), id, ctx.Err())
+
+	return abortError(ctx, timeout)
+}
+
+// cancel tells the server to stop working on the request of the session, the request itself has been aborted
+func (c *RestClient) cancel(sessionID string, id int64, reason error) {
+	fmt.Printf("cancel request %d: %v\n", id, reason)
+
+	go func() {
+		if err := c.post(cancelNotification(id, reason), sessionID); err != nil {
+			fmt.Printf("failed to send cancelled notification: %v\n", err)
 		}
-		// If no data field found, return original response
-		return responseBody, nil
+	}()
+}
+
+// post sends a message of the session that expects no response, such as a notification or a response
+// to a server request
+func (c *RestClient) post(message []byte, sessionID string) error {
+	req, err := http.NewRequestWithContext(c.ctx, "POST", c.serverConfig.ServerURL, bytes.NewReader(message))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setHeaders(req, sessionID, true)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
+
+// setHeaders sets the headers of a message of the downstream session, with the session the backend assigned
+// on its initialize when session is true
+func (c *RestClient) setHeaders(req *http.Request, sessionID string, session bool) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	if !session {
+		return
+	}
+
+	c.smu.RLock()
+	upstream := c.sessions[sessionID]
+	c.smu.RUnlock()
+
+	if upstream.id != "" {
+		req.Header.Set(headerMcpSessionID, upstream.id)
+	}
+	if upstream.protocolVersion != "" {
+		req.Header.Set(headerMcpProtocolVersion, upstream.protocolVersion)
+	}
+}
+
+// saveSession records the session id and the protocol version of the initialize response of the backend
+// for the downstream session, the sessions of other downstream sessions are left alone
+func (c *RestClient) saveSession(sessionID string, header http.Header, response []byte) {
+	version := gjson.GetBytes(response, "result.protocolVersion").String()
+	if version == "" {
+		return
 	}
 
-	return responseBody, nil
+	c.smu.Lock()
+	c.sessions[sessionID] = upstreamSession{id: header.Get(headerMcpSessionID), protocolVersion: version}
+	c.smu.Unlock()
+}
+
+// BindSession returns the client for the session, the backend session is picked by the session of the request context
+func (c *RestClient) BindSession(sessionID string) Client {
+	return c
+}
+
+// ReleaseSession forgets the backend session of the downstream session and terminates it on the backend
+func (c *RestClient) ReleaseSession(sessionID string) {
+	c.smu.Lock()
+	upstream, ok := c.sessions[sessionID]
+	delete(c.sessions, sessionID)
+	c.smu.Unlock()
+
+	if !ok || upstream.id == "" {
+		return
+	}
+
+	go func() {
+		req, err := http.NewRequestWithContext(c.ctx, http.MethodDelete, c.serverConfig.ServerURL, nil)
+		if err != nil {
+			return
+		}
+		req.Header.Set(headerMcpSessionID, upstream.id)
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			fmt.Printf("failed to terminate backend session %s: %v\n", upstream.id, err)
+			return
+		}
+		resp.Body.Close()
+	}()
 }
 
 // ForwardMessage forwards a JSON-RPC message to the MCP server and returns the response
-func (c *RestClient) ForwardMessage(request *jsonrpc.Request) (*jsonrpc.Response, error) {
+func (c *RestClient) ForwardMessage(ctx context.Context, request *jsonrpc.Request) (*jsonrpc.Response, error) {
 	req, err := json.Marshal(request)
 	if err != nil {
 		return nil, err
 	}
 
-	res, err := c.SendMessage(req)
+	res, err := c.SendMessage(ctx, req)
 	if err != nil {
 		fmt.Printf("failed to forward message: %v\n", err)
 		return nil, err
@@ -216,11 +420,8 @@ func (c *RestClient) ForwardMessage(request *jsonrpc.Request) (*jsonrpc.Response
 		return nil, nil
 	}
 
-	// Add debug information
-	fmt.Printf("Attempting to parse response: %s\n", string(res))
-
-	response := &jsonrpc.Response{}
-	if err := json.Unmarshal(res, response); err != nil {
+	response, err := jsonrpc.UnmarshalResponse(res)
+	if err != nil {
 		return nil, err
 	}
 
@@ -228,10 +429,10 @@ func (c *RestClient) ForwardMessage(request *jsonrpc.Request) (*jsonrpc.Response
 }
 
 // Initialize initializes the client.
-func (c *RestClient) Initialize(params *jsonrpc.InitializeParams) (*jsonrpc.InitializeResult, error) {
+func (c *RestClient) Initialize(ctx context.Context, params *jsonrpc.InitializeParams) (*jsonrpc.InitializeResult, error) {
 	request := jsonrpc.NewRequest(jsonrpc.MethodInitialize, params, 0)
 
-	response, err := c.ForwardMessage(request)
+	response, err := c.ForwardMessage(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -249,10 +450,10 @@ func (c *RestClient) Initialize(params *jsonrpc.InitializeParams) (*jsonrpc.Init
 }
 
 // NotificationsInitialized sends the initialized notification to the server.
-func (c *RestClient) NotificationsInitialized() error {
+func (c *RestClient) NotificationsInitialized(ctx context.Context) error {
 	request := jsonrpc.NewRequest(jsonrpc.MethodInitializedNotification, nil, nil)
 
-	_, err := c.ForwardMessage(request)
+	_, err := c.ForwardMessage(ctx, request)
 	if err != nil {
 		return err
 	}
@@ -261,10 +462,10 @@ func (c *RestClient) NotificationsInitialized() error {
 }
 
 // ListTools lists the tools available in the MCP server.
-func (c *RestClient) ListTools() (*jsonrpc.ListToolsResult, error) {
+func (c *RestClient) ListTools(ctx context.Context) (*jsonrpc.ListToolsResult, error) {
 	request := jsonrpc.NewRequest(jsonrpc.MethodListTools, nil, 1)
 
-	response, err := c.ForwardMessage(request)
+	response, err := c.ForwardMessage(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -282,10 +483,10 @@ func (c *RestClient) ListTools() (*jsonrpc.ListToolsResult, error) {
 }
 
 // CallTool calls a tool with the given name and arguments.
-func (c *RestClient) CallTool(params *jsonrpc.CallToolParams) (*jsonrpc.CallToolResult, error) {
+func (c *RestClient) CallTool(ctx context.Context, params *jsonrpc.CallToolParams) (*jsonrpc.CallToolResult, error) {
 	request := jsonrpc.NewRequest(jsonrpc.MethodCallTool, params, 1)
 
-	response, err := c.ForwardMessage(request)
+	response, err := c.ForwardMessage(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,119 @@
+package mcpclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+	"github.com/tidwall/gjson"
+)
+
+func TestRestClientClose(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, err := NewRestClient(&mcpserver.ServerConfig{ServerURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.SendMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+		errs <- err
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	client.Close()
+
+	select {
+	case err := <-errs:
+		if err == nil || err.Error() != "client closed" {
+			t.Errorf("SendMessage() error = %v, want client closed", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("request in flight not cancelled by Close")
+	}
+
+	if _, err := client.SendMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)); err == nil {
+		t.Error("SendMessage() on a closed client succeeded")
+	}
+}
+
+func TestRestClientSessions(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		next       int
+		seen       = map[string]string{} // upstream session of the last tools/list, by request id
+		terminated = make(chan string, 1)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			terminated <- r.Header.Get(headerMcpSessionID)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		msg := gjson.ParseBytes(body)
+		w.Header().Set("Content-Type", "application/json")
+
+		mu.Lock()
+		defer mu.Unlock()
+		if msg.Get("method").String() == "initialize" {
+			next++
+			w.Header().Set(headerMcpSessionID, fmt.Sprintf("upstream-%d", next))
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":{"protocolVersion":"2025-03-26"}}`, msg.Get("id").Raw)
+			return
+		}
+		seen[msg.Get("params.name").String()] = r.Header.Get(headerMcpSessionID)
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":{}}`, msg.Get("id").Raw)
+	}))
+	defer server.Close()
+
+	client, err := NewRestClient(&mcpserver.ServerConfig{ServerURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	send := func(sessionID string, message string) {
+		if _, err := client.SendMessage(WithSession(context.Background(), sessionID), []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the second initialize must not move the first session to the new backend session
+	send("a", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+	send("b", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+	send("a", `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"a"}}`)
+	send("b", `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"b"}}`)
+
+	mu.Lock()
+	if seen["a"] != "upstream-1" || seen["b"] != "upstream-2" {
+		t.Errorf("backend sessions = %v, want a on upstream-1 and b on upstream-2", seen)
+	}
+	mu.Unlock()
+
+	client.ReleaseSession("a")
+	select {
+	case id := <-terminated:
+		if id != "upstream-1" {
+			t.Errorf("terminated backend session %s, want upstream-1", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("backend session not terminated on release")
+	}
+}
@@ -0,0 +1,116 @@
+package mcpclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// sessionContextKey is the context key of the downstream session a request is sent for
+type sessionContextKey struct{}
+
+// WithSession returns a context carrying the downstream session a request is sent for, the messages
+// the backend sends about the request are routed to that session
+func WithSession(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, sessionID)
+}
+
+// sessionFromContext returns the downstream session of the request, empty when not known
+func sessionFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionContextKey{}).(string)
+	return sessionID
+}
+
+// requestRoute is the downstream session and progress token of a request in flight
+type requestRoute struct {
+	sessionID     string
+	progressToken string // raw JSON of the client progress token, empty when the request has none
+}
+
+// requestRoutes tracks the requests in flight on a backend by upstream id, so that the messages
+// the backend sends about a request reach the session that sent it. The zero value is ready to use.
+type requestRoutes struct {
+	mu       sync.Mutex
+	requests map[int64]requestRoute
+}
+
+// add records the request of the upstream id, its progress token is replaced with the upstream id,
+// which is unique to the backend where the tokens of many clients are not
+func (r *requestRoutes) add(ctx context.Context, id int64, message []byte) ([]byte, error) {
+	route := requestRoute{sessionID: sessionFromContext(ctx)}
+
+	if token := gjson.GetBytes(message, "params._meta.progressToken"); token.Exists() {
+		route.progressToken = token.Raw
+
+		var err error
+		message, err = sjson.SetBytes(message, "params._meta.progressToken", id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewrite progress token: %w", err)
+		}
+	}
+
+	r.mu.Lock()
+	if r.requests == nil {
+		r.requests = make(map[int64]requestRoute)
+	}
+	r.requests[id] = route
+	r.mu.Unlock()
+
+	return message, nil
+}
+
+// remove forgets the request of the upstream id once it is answered
+func (r *requestRoutes) remove(id int64) {
+	r.mu.Lock()
+	delete(r.requests, id)
+	r.mu.Unlock()
+}
+
+// session returns the session of the requests in flight when they all come from one session, empty otherwise
+func (r *requestRoutes) session() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sessionID := ""
+	for _, route := range r.requests {
+		if route.sessionID == "" || (sessionID != "" && route.sessionID != sessionID) {
+			return ""
+		}
+		sessionID = route.sessionID
+	}
+
+	return sessionID
+}
+
+// notification returns the session a notification of the backend is meant for, empty when it cannot be tied
+// to one. Progress notifications belong to the session of their request and get the client progress token
+// back, other notifications belong to the session of the requests in flight when there is only one.
+func (r *requestRoutes) notification(message []byte) (string, []byte) {
+	if gjson.GetBytes(message, "method").String() != jsonrpc.MethodProgressNotification {
+		return r.session(), message
+	}
+
+	token := gjson.GetBytes(message, "params.progressToken")
+	if token.Type != gjson.Number {
+		return "", message
+	}
+
+	r.mu.Lock()
+	route, ok := r.requests[token.Int()]
+	r.mu.Unlock()
+
+	if !ok || route.progressToken == "" {
+		return "", message
+	}
+
+	restored, err := sjson.SetRawBytes(message, "params.progressToken", []byte(route.progressToken))
+	if err != nil {
+		return "", message
+	}
+
+	return route.sessionID, restored
+}
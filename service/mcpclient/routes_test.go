@@ -0,0 +1,81 @@
+package mcpclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestRequestRoutesProgress(t *testing.T) {
+	var routes requestRoutes
+
+	tests := []struct {
+		name     string
+		id       int64
+		session  string
+		request  string
+		token    string // progress token of the notification, in raw JSON
+		wantSent string // progress token sent to the backend
+		wantBack string // progress token delivered to the session
+		wantTo   string
+	}{
+		{"string token", 1, "s1", `{"params":{"_meta":{"progressToken":"t"}}}`, `1`, `1`, `"t"`, "s1"},
+		{"number token", 2, "s2", `{"params":{"_meta":{"progressToken":1}}}`, `2`, `2`, `1`, "s2"},
+		{"unknown token", 3, "s3", `{"params":{}}`, `99`, ``, `99`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := routes.add(WithSession(context.Background(), tt.session), tt.id, []byte(tt.request))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := gjson.GetBytes(message, "params._meta.progressToken").Raw; got != tt.wantSent {
+				t.Errorf("sent token = %s, want %s", got, tt.wantSent)
+			}
+
+			notification := `{"jsonrpc":"2.0","method":"notifications/progress","params":{"progressToken":` + tt.token + `}}`
+			to, restored := routes.notification([]byte(notification))
+			if to != tt.wantTo {
+				t.Errorf("session = %q, want %q", to, tt.wantTo)
+			}
+			if got := gjson.GetBytes(restored, "params.progressToken").Raw; got != tt.wantBack {
+				t.Errorf("restored token = %s, want %s", got, tt.wantBack)
+			}
+		})
+	}
+}
+
+func TestRequestRoutesSession(t *testing.T) {
+	tests := []struct {
+		name     string
+		sessions []string
+		want     string
+	}{
+		{"none", nil, ""},
+		{"one session", []string{"a", "a"}, "a"},
+		{"two sessions", []string{"a", "b"}, ""},
+		{"unknown session", []string{"a", ""}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var routes requestRoutes
+			for i, session := range tt.sessions {
+				if _, err := routes.add(WithSession(context.Background(), session), int64(i), []byte(`{}`)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := routes.session(); got != tt.want {
+				t.Errorf("session() = %q, want %q", got, tt.want)
+			}
+
+			to, _ := routes.notification([]byte(`{"jsonrpc":"2.0","method":"notifications/message"}`))
+			if to != tt.want {
+				t.Errorf("notification session = %q, want %q", to, tt.want)
+			}
+		})
+	}
+}
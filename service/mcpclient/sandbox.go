@@ -0,0 +1,117 @@
+package mcpclient
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+)
+
+// Sandbox limits a stdio server can violate, reported in the Violation of a BackendError
+const (
+	ViolationCPU       = "cpu"
+	ViolationMemory    = "memory"
+	ViolationOpenFiles = "open_files"
+	ViolationPrivilege = "privilege"
+)
+
+// defaultEnvAllowlist are the environment variables passed to a sandboxed server with no env_allowlist
+var defaultEnvAllowlist = []string{"PATH", "LANG", "TZ"}
+
+// violationStderrPatterns are the stderr outputs of a server that ran into a limit, matched case-insensitively
+var violationStderrPatterns = map[string][]string{
+	ViolationMemory:    {"cannot allocate memory", "out of memory", "memoryerror", "std::bad_alloc"},
+	ViolationOpenFiles: {"too many open files", "emfile"},
+	ViolationPrivilege: {"operation not permitted", "eperm"},
+}
+
+// ulimitCommands returns the ulimit commands setting the limits of the sandbox, one limit per command
+// as some shells take a single one
+func ulimitCommands(sandbox *mcpserver.SandboxConfig) string {
+	var commands []string
+	if sandbox.CPUSeconds > 0 {
+		commands = append(commands, fmt.Sprintf("ulimit -t %d", sandbox.CPUSeconds))
+	}
+	if sandbox.MemoryMB > 0 {
+		commands = append(commands, fmt.Sprintf("ulimit -v %d", sandbox.MemoryMB*1024))
+	}
+	if sandbox.OpenFiles > 0 {
+		commands = append(commands, fmt.Sprintf("ulimit -n %d", sandbox.OpenFiles))
+	}
+
+	return strings.Join(commands, " && ")
+}
+
+// sandboxEnv returns the allowed variables of the environment of the router,
+// HOME is the temporary directory of the process when it has one
+func sandboxEnv(sandbox *mcpserver.SandboxConfig, tempDir string) []string {
+	allowlist := sandbox.EnvAllowlist
+	if len(allowlist) == 0 {
+		allowlist = defaultEnvAllowlist
+	}
+
+	env := []string{}
+	for _, name := range allowlist {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+
+	if tempDir != "" {
+		env = append(env, "HOME="+tempDir, "TMPDIR="+tempDir)
+	}
+
+	return env
+}
+
+// exitSignal returns the signal that killed the process, or the command run by its shell
+func exitSignal(state *os.ProcessState) (syscall.Signal, bool) {
+	if state == nil {
+		return 0, false
+	}
+
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return status.Signal(), true
+	}
+
+	// shells exit with 128 + the signal of the command
+	if code := state.ExitCode(); code > 128 && code < 160 {
+		return syscall.Signal(code - 128), true
+	}
+
+	return 0, false
+}
+
+// sandboxViolation returns the limit of the sandbox the exited process ran into, if any
+func sandboxViolation(sandbox *mcpserver.SandboxConfig, state *os.ProcessState, stderr []string) string {
+	if sandbox == nil {
+		return ""
+	}
+
+	if signal, ok := exitSignal(state); ok {
+		switch {
+		case signal == cpuLimitSignal:
+			return ViolationCPU
+		case signal == syscall.SIGKILL && sandbox.CPUSeconds > 0:
+			// killed on reaching the hard cpu limit
+			return ViolationCPU
+		case (signal == syscall.SIGSEGV || signal == syscall.SIGABRT) && sandbox.MemoryMB > 0:
+			return ViolationMemory
+		}
+	}
+
+	for _, line := range stderr {
+		line = strings.ToLower(line)
+		for violation, patterns := range violationStderrPatterns {
+			for _, pattern := range patterns {
+				if strings.Contains(line, pattern) {
+					return violation
+				}
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,88 @@
+//go:build linux
+
+package mcpclient
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+)
+
+// namespaceFlags are the clone flags of the linux namespaces a server can run in
+var namespaceFlags = map[string]uintptr{
+	"user":  syscall.CLONE_NEWUSER,
+	"pid":   syscall.CLONE_NEWPID,
+	"net":   syscall.CLONE_NEWNET,
+	"ipc":   syscall.CLONE_NEWIPC,
+	"uts":   syscall.CLONE_NEWUTS,
+	"mount": syscall.CLONE_NEWNS,
+}
+
+// prSetNoNewPrivs is the prctl option keeping a thread and the processes it starts from gaining privileges
+const prSetNoNewPrivs = 38
+
+// isolate runs the command as the user of the sandbox and in its namespaces,
+// the temporary directory of the process is given to the user it runs as
+func isolate(cmd *exec.Cmd, sandbox *mcpserver.SandboxConfig, tempDir string) error {
+	attr := cmd.SysProcAttr
+
+	if sandbox.UID > 0 || sandbox.GID > 0 {
+		uid, gid := sandbox.UID, sandbox.GID
+		if uid == 0 {
+			uid = os.Getuid()
+		}
+		if gid == 0 {
+			gid = os.Getgid()
+		}
+		attr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	}
+
+	for _, namespace := range sandbox.Namespaces {
+		flag, ok := namespaceFlags[namespace]
+		if !ok {
+			return fmt.Errorf("unknown namespace: %s", namespace)
+		}
+		attr.Cloneflags |= flag
+	}
+
+	// the user of the router is root in its user namespace
+	if attr.Cloneflags&syscall.CLONE_NEWUSER != 0 {
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+		attr.Credential = nil
+	}
+
+	if attr.Credential != nil && tempDir != "" {
+		if err := os.Chown(tempDir, int(attr.Credential.Uid), int(attr.Credential.Gid)); err != nil {
+			return fmt.Errorf("failed to chown temp dir: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// startCommand starts the command, with no_new_privs set when the sandbox asks for it. The flag is set on a
+// locked thread the process is forked from, the thread is never unlocked so that it exits with its goroutine.
+func startCommand(cmd *exec.Cmd, sandbox *mcpserver.SandboxConfig) error {
+	if sandbox == nil || !sandbox.NoNewPrivs {
+		return cmd.Start()
+	}
+
+	started := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+
+		if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+			started <- fmt.Errorf("failed to set no_new_privs: %w", errno)
+			return
+		}
+
+		started <- cmd.Start()
+	}()
+
+	return <-started
+}
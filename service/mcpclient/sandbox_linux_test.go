@@ -0,0 +1,43 @@
+//go:build linux
+
+package mcpclient
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+)
+
+func TestStartCommandNoNewPrivs(t *testing.T) {
+	tests := []struct {
+		name    string
+		sandbox *mcpserver.SandboxConfig
+		want    string
+	}{
+		{"no sandbox", nil, "NoNewPrivs:\t0"},
+		{"no_new_privs", &mcpserver.SandboxConfig{NoNewPrivs: true}, "NoNewPrivs:\t1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, _, err := newCommand(&mcpserver.ServerConfig{Command: "grep NoNewPrivs /proc/self/status", Sandbox: tt.sandbox})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out strings.Builder
+			cmd.Stdout = &out
+			if err := startCommand(cmd, tt.sandbox); err != nil {
+				t.Fatal(err)
+			}
+			if err := cmd.Wait(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.TrimSpace(out.String()); got != tt.want {
+				t.Errorf("status = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
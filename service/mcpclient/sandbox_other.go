@@ -0,0 +1,29 @@
+//go:build !linux
+
+package mcpclient
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+)
+
+// isolate fails when the sandbox asks for isolation only linux provides
+func isolate(cmd *exec.Cmd, sandbox *mcpserver.SandboxConfig, tempDir string) error {
+	if sandbox.UID > 0 || sandbox.GID > 0 || len(sandbox.Namespaces) > 0 {
+		return fmt.Errorf("sandbox uid, gid and namespaces are only supported on linux")
+	}
+
+	return nil
+}
+
+// startCommand starts the command, no_new_privs is only supported on linux and is skipped
+func startCommand(cmd *exec.Cmd, sandbox *mcpserver.SandboxConfig) error {
+	if sandbox != nil && sandbox.NoNewPrivs {
+		log.Printf("sandbox no_new_privs is only supported on linux, skipped for %s", cmd.Path)
+	}
+
+	return cmd.Start()
+}
@@ -0,0 +1,507 @@
+package mcpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// SSEClient is a client that uses the legacy HTTP+SSE transport (protocol version 2024-11-05) to communicate
+// with the backend mcp server: messages are received on a GET event stream and sent to the endpoint it announces.
+type SSEClient struct {
+	serverConfig  *mcpserver.ServerConfig
+	httpClient    *http.Client
+	stream        io.ReadCloser         // event stream body
+	endpoint      string                // messages endpoint announced by the server
+	ready         chan struct{}         // endpoint received signal
+	done          chan struct{}         // client closed signal
+	messages      map[int64]chan []byte // response messages channel
+	mu            sync.RWMutex
+	notifications []NotificationHandler // notification handlers
+	requests      RequestHandler        // server request handler
+	nmu           sync.RWMutex
+	nextID        atomic.Int64  // upstream request id sequence
+	routes        requestRoutes // sessions of the requests in flight
+	err           chan error    // error channel
+}
+
+// NewSSEClient creates a new SSEClient, it connects to the event stream and waits for the messages endpoint.
+func NewSSEClient(serverConfig *mcpserver.ServerConfig) (*SSEClient, error) {
+	req, err := http.NewRequest("GET", serverConfig.ServerURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "text/event-stream")
+
+	// the event stream stays open for the client lifetime, so it has no timeout
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to event stream: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("event stream returned status code %d", resp.StatusCode)
+	}
+
+	client := &SSEClient{
+		serverConfig: serverConfig,
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		stream:       resp.Body,
+		ready:        make(chan struct{}),
+		done:         make(chan struct{}),
+		messages:     make(map[int64]chan []byte),
+		err:          make(chan error, 1),
+	}
+
+	fmt.Printf("mcp server connecting to: %s\n", serverConfig.ServerURL)
+
+	// listen event stream
+	go client.listen()
+
+	select {
+	case <-client.ready:
+	case <-client.done:
+		return nil, fmt.Errorf("event stream closed with no endpoint")
+	case <-time.After(30 * time.Second):
+		client.Close()
+		return nil, fmt.Errorf("timeout waiting for endpoint after 30 seconds")
+	}
+
+	fmt.Printf("mcp server messages endpoint: %s\n", client.endpoint)
+
+	return client, nil
+}
+
+// listen for events from the backend mcp server.
+func (c *SSEClient) listen() {
+	defer c.Close()
+
+	err := readEvents(c.stream, func(event string, data []byte) bool {
+		switch event {
+		case "endpoint":
+			c.setEndpoint(string(data))
+		case "", "message":
+			c.handle(data)
+		}
+		return false
+	})
+
+	if err != nil && err != io.EOF && !c.closed() {
+		fmt.Printf("failed to read event stream: %v\n", err)
+	}
+}
+
+// setEndpoint resolves the announced endpoint against the server url, only the first one is used
+func (c *SSEClient) setEndpoint(endpoint string) {
+	select {
+	case <-c.ready:
+		return
+	default:
+	}
+
+	base, err := url.Parse(c.serverConfig.ServerURL)
+	if err != nil {
+		fmt.Printf("invalid server url: %v\n", err)
+		return
+	}
+
+	ref, err := url.Parse(strings.TrimSpace(endpoint))
+	if err != nil {
+		fmt.Printf("invalid endpoint: %s\n", endpoint)
+		return
+	}
+
+	c.endpoint = base.ResolveReference(ref).String()
+	close(c.ready)
+}
+
+// handle dispatches a message received on the event stream
+func (c *SSEClient) handle(message []byte) {
+	msg := gjson.ParseBytes(message)
+	if msg.Get("jsonrpc").String() != jsonrpc.JSONRPC_VERSION {
+		fmt.Printf("invalid response message: %s\n", message)
+		return
+	}
+
+	// notification message
+	if !msg.Get("id").Exists() {
+		sessionID, message := c.routes.notification(message)
+
+		c.nmu.RLock()
+		for _, handler := range c.notifications {
+			handler(sessionID, message)
+		}
+		c.nmu.RUnlock()
+		return
+	}
+
+	// request message initiated by the server, answered with a new POST
+	if msg.Get("method").Exists() {
+		c.nmu.RLock()
+		handler := c.requests
+		c.nmu.RUnlock()
+
+		// the server request comes with the requests in flight, it is tied to their session
+		sessionID := c.routes.session()
+
+		go func() {
+			response, err := handleServerRequest(handler, sessionID, message)
+			if err != nil {
+				fmt.Printf("failed to build server request response: %v\n", err)
+				return
+			}
+
+			if err := c.post(response); err != nil {
+				fmt.Printf("failed to send server request response: %v\n", err)
+			}
+		}()
+		return
+	}
+
+	// result or error message
+	id := msg.Get("id").Int()
+
+	c.mu.RLock()
+	msgch, ok := c.messages[id]
+	c.mu.RUnlock()
+
+	if !ok {
+		// response message without corresponding request
+		fmt.Printf("isolated response message: %s\n", message)
+		return
+	}
+
+	msgch <- message
+}
+
+// Error returns the error message
+func (c *SSEClient) Error() error {
+	select {
+	case err := <-c.err:
+		return err
+	default:
+		return nil
+	}
+}
+
+// Close client
+func (c *SSEClient) Close() error {
+	c.mu.Lock()
+	select {
+	case <-c.done:
+		c.mu.Unlock()
+		return nil
+	default:
+		close(c.done)
+		c.mu.Unlock()
+	}
+
+	return c.stream.Close()
+}
+
+// closed reports whether the client has been closed
+func (c *SSEClient) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// OnNotification adds a notification handler
+func (c *SSEClient) OnNotification(handler NotificationHandler) {
+	c.nmu.Lock()
+	c.notifications = append(c.notifications, handler)
+	c.nmu.Unlock()
+}
+
+// OnRequest sets the handler for requests initiated by the server
+func (c *SSEClient) OnRequest(handler RequestHandler) {
+	c.nmu.Lock()
+	c.requests = handler
+	c.nmu.Unlock()
+}
+
+// post sends a message to the messages endpoint, the response of a request arrives on the event stream
+func (c *SSEClient) post(message []byte) error {
+	req, err := http.NewRequest("POST", c.endpoint, bytes.NewReader(message))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status code %d: %s", resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+// SendMessage sends a JSON-RPC message to the MCP server and returns the response
+func (c *SSEClient) SendMessage(ctx context.Context, message []byte) ([]byte, error) {
+	fmt.Printf("sending message: %s\n", message)
+
+	// parsed message
+	msg := gjson.ParseBytes(message)
+	if msg.Get("jsonrpc").String() != jsonrpc.JSONRPC_VERSION {
+		return nil, fmt.Errorf("invalid request message: %s", message)
+	}
+
+	serverParams := map[string]interface{}{}
+	if c.serverConfig.ServerParams != "" {
+		if err := json.Unmarshal([]byte(c.serverConfig.ServerParams), &serverParams); err != nil {
+			fmt.Printf("failed to unmarshal server params: %v\n", err)
+		}
+	}
+
+	metadata := map[string]interface{}{
+		"auth": serverParams,
+	}
+
+	var err error
+
+	// keep the client _meta, such as progressToken, and add the auth params
+	message, err = sjson.SetBytes(message, "params._meta.auth", serverParams)
+	if err != nil {
+		return nil, fmt.Errorf("failed to modify message: %w", err)
+	}
+
+	if msg.Get("method").String() == "initialize" {
+		message, err = sjson.SetBytes(message, "params.capabilities.experimental", metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to modify initialize message: %w", err)
+		}
+	}
+
+	if !msg.Get("id").Exists() {
+		// notification message
+		if err := c.post(message); err != nil {
+			return nil, fmt.Errorf("failed to send notification: %w", err)
+		}
+
+		fmt.Printf("sent notification message: %s\n", message)
+
+		return nil, nil
+	}
+
+	// not notification message, assign an upstream id unique to this backend
+	id := c.nextID.Add(1)
+
+	message, err = rewriteID(message, id)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err = c.routes.add(ctx, id, message)
+	if err != nil {
+		return nil, err
+	}
+	defer c.routes.remove(id)
+
+	// message channel
+	msgch := make(chan []byte, 1)
+
+	c.mu.Lock()
+	c.messages[id] = msgch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.messages, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.post(message); err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	// a timeout fails the request only, the backend keeps running
+	timeout := requestTimeout(c.serverConfig, msg)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// wait for response on the event stream
+	select {
+	case <-c.done:
+		fmt.Println("client closed with no response")
+		return nil, fmt.Errorf("client closed with no response")
+	case <-ctx.Done():
+		c.cancel(id, ctx.Err())
+		return nil, abortError(ctx, timeout)
+	case response := <-msgch:
+		return restoreID(response, msg.Get("id"))
+	}
+}
+
+// cancel tells the server to stop working on the request
+func (c *SSEClient) cancel(id int64, reason error) {
+	fmt.Printf("cancel request %d: %v\n", id, reason)
+
+	// the response of the request is not waited for, send the notification in the background
+	go func() {
+		if err := c.post(cancelNotification(id, reason)); err != nil {
+			fmt.Printf("failed to send cancelled notification: %v\n", err)
+		}
+	}()
+}
+
+// ForwardMessage forwards a JSON-RPC message to the MCP server and returns the response
+func (c *SSEClient) ForwardMessage(ctx context.Context, request *jsonrpc.Request) (*jsonrpc.Response, error) {
+	req, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.SendMessage(ctx, req)
+	if err != nil {
+		fmt.Printf("failed to forward message: %v\n", err)
+		return nil, err
+	}
+
+	// notification message with no response
+	if res == nil {
+		return nil, nil
+	}
+
+	response, err := jsonrpc.UnmarshalResponse(res)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// Initialize initializes the client.
+func (c *SSEClient) Initialize(ctx context.Context, params *jsonrpc.InitializeParams) (*jsonrpc.InitializeResult, error) {
+	request := jsonrpc.NewRequest(jsonrpc.MethodInitialize, params, 0)
+
+	response, err := c.ForwardMessage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	result := &jsonrpc.InitializeResult{}
+	if err := response.UnmarshalResult(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// NotificationsInitialized sends the initialized notification to the server.
+func (c *SSEClient) NotificationsInitialized(ctx context.Context) error {
+	request := jsonrpc.NewRequest(jsonrpc.MethodInitializedNotification, nil, nil)
+
+	_, err := c.ForwardMessage(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListTools lists the tools available in the MCP server.
+func (c *SSEClient) ListTools(ctx context.Context) (*jsonrpc.ListToolsResult, error) {
+	request := jsonrpc.NewRequest(jsonrpc.MethodListTools, nil, 1)
+
+	response, err := c.ForwardMessage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	result := &jsonrpc.ListToolsResult{}
+	if err := response.UnmarshalResult(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CallTool calls a tool with the given name and arguments.
+func (c *SSEClient) CallTool(ctx context.Context, params *jsonrpc.CallToolParams) (*jsonrpc.CallToolResult, error) {
+	request := jsonrpc.NewRequest(jsonrpc.MethodCallTool, params, 1)
+
+	response, err := c.ForwardMessage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	result := &jsonrpc.CallToolResult{}
+	if err := response.UnmarshalResult(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// readEvents reads a server-sent event stream and calls handle for each event until it returns true,
+// it returns io.EOF when the stream ends first
+func readEvents(body io.Reader, handle func(event string, data []byte) bool) error {
+	reader := bufio.NewReader(body)
+	event := ""
+	data := []string{}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "event:") {
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		} else if strings.HasPrefix(line, "data:") {
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+
+		// a blank line or the end of stream dispatches the event, other fields are ignored
+		if line == "" || err == io.EOF {
+			if len(data) > 0 && handle(event, []byte(strings.Join(data, "\n"))) {
+				return nil
+			}
+			event = ""
+			data = data[:0]
+		}
+
+		if err == io.EOF {
+			return io.EOF
+		}
+	}
+}
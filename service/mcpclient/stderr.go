@@ -0,0 +1,139 @@
+package mcpclient
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	stderrBufferSize = 200 // lines kept per backend process
+	stderrTailSize   = 20  // lines returned with errors
+)
+
+// Causes of a failed backend told by its stderr, reported in the Cause of a BackendError
+const (
+	CauseCommandNotFound = "command_not_found"
+	CausePackageNotFound = "package_not_found"
+	CauseModuleNotFound  = "module_not_found"
+	CauseFileNotFound    = "file_not_found"
+	CausePermission      = "permission_denied"
+	CauseAuth            = "auth_failed"
+	CauseAddressInUse    = "address_in_use"
+)
+
+// stderrCauses are the stderr outputs of a backend that failed to start, matched case-insensitively
+// in order, so that the more specific causes come first
+var stderrCauses = []struct {
+	cause    string
+	patterns []string
+}{
+	{CausePackageNotFound, []string{"npm err! 404", "npm error 404", "e404", "no matching version found", "could not find a version that satisfies"}},
+	{CauseModuleNotFound, []string{"cannot find module", "modulenotfounderror", "no module named"}},
+	{CauseCommandNotFound, []string{"command not found", ": not found", "executable file not found"}},
+	{CauseFileNotFound, []string{"enoent", "no such file or directory"}},
+	{CausePermission, []string{"permission denied", "eacces", "operation not permitted"}},
+	{CauseAuth, []string{"invalid api key", "unauthorized", "authentication failed", "invalid token"}},
+	{CauseAddressInUse, []string{"eaddrinuse", "address already in use"}},
+}
+
+// stderrCause returns the cause of a failed start the stderr line tells, if any
+func stderrCause(line string) string {
+	line = strings.ToLower(line)
+	for _, c := range stderrCauses {
+		for _, pattern := range c.patterns {
+			if strings.Contains(line, pattern) {
+				return c.cause
+			}
+		}
+	}
+
+	return ""
+}
+
+// classifyStderr returns the cause told by the first stderr line that tells one, if any
+func classifyStderr(lines []string) string {
+	for _, line := range lines {
+		if cause := stderrCause(line); cause != "" {
+			return cause
+		}
+	}
+
+	return ""
+}
+
+// stderrBuffer is a bounded ring of stderr lines
+type stderrBuffer struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+// add appends a line, dropping the oldest one when the buffer is full
+func (b *stderrBuffer) add(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lines = append(b.lines, line)
+	if len(b.lines) > stderrBufferSize {
+		b.lines = b.lines[len(b.lines)-stderrBufferSize:]
+	}
+}
+
+// tail returns the last n lines, all of them when n is not positive
+func (b *stderrBuffer) tail(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]string(nil), tailLines(b.lines, n)...)
+}
+
+// stderrReporter is implemented by clients running backend processes
+type stderrReporter interface {
+	Stderr(n int) []string
+}
+
+// Stderr returns the last n stderr lines of the backend processes of the client, none for remote servers
+func Stderr(client Client, n int) []string {
+	if reporter, ok := client.(stderrReporter); ok {
+		return reporter.Stderr(n)
+	}
+
+	return []string{}
+}
+
+// tailLines returns the last n lines, all of them when n is not positive
+func tailLines(lines []string, n int) []string {
+	if n <= 0 || n > len(lines) {
+		n = len(lines)
+	}
+
+	return lines[len(lines)-n:]
+}
+
+// BackendError is an error of a backend process, with the tail of its stderr to diagnose it,
+// the cause its stderr tells and the limit of the sandbox it ran into
+type BackendError struct {
+	Err       error
+	Stderr    []string
+	Cause     string
+	Violation string
+}
+
+// newBackendError returns the error of a backend process with the stderr lines it wrote, they are
+// classified in full and their tail is kept
+func newBackendError(err error, stderr []string) *BackendError {
+	return &BackendError{
+		Err:    err,
+		Stderr: append([]string(nil), tailLines(stderr, stderrTailSize)...),
+		Cause:  classifyStderr(stderr),
+	}
+}
+
+// Error returns the message of the error
+func (e *BackendError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *BackendError) Unwrap() error {
+	return e.Err
+}
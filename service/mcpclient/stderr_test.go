@@ -0,0 +1,48 @@
+package mcpclient
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassifyStderr(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{"no stderr", nil, ""},
+		{"warnings only", []string{"Server running on stdio", "ExperimentalWarning: fetch"}, ""},
+		{"missing npx package", []string{"npm ERR! code E404", "npm ERR! 404 Not Found - GET https://registry.npmjs.org/@x%2fy"}, CausePackageNotFound},
+		{"missing node module", []string{"Error: Cannot find module 'express'"}, CauseModuleNotFound},
+		{"missing python module", []string{"Traceback (most recent call last):", "ModuleNotFoundError: No module named 'mcp'"}, CauseModuleNotFound},
+		{"missing command", []string{"sh: 1: uvx: not found"}, CauseCommandNotFound},
+		{"missing file", []string{"Error: ENOENT: no such file or directory, open '/data/config.json'"}, CauseFileNotFound},
+		{"auth failure", []string{"starting", "Error: Invalid API key provided"}, CauseAuth},
+		{"first cause wins", []string{"Error: listen EADDRINUSE: address already in use :::3000", "Unauthorized"}, CauseAddressInUse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyStderr(tt.lines); got != tt.want {
+				t.Errorf("classifyStderr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBackendError(t *testing.T) {
+	lines := []string{"npm ERR! 404 Not Found"}
+	for i := 0; i < stderrTailSize+5; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+
+	berr := newBackendError(errors.New("exited"), lines)
+	if berr.Cause != CausePackageNotFound {
+		t.Errorf("Cause = %q, want %q from a line out of the tail", berr.Cause, CausePackageNotFound)
+	}
+	if len(berr.Stderr) != stderrTailSize || berr.Stderr[0] != "line 5" {
+		t.Errorf("Stderr = %q, want the last %d lines", berr.Stderr, stderrTailSize)
+	}
+}
@@ -2,12 +2,15 @@ package mcpclient
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
-	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chatmcp/mcprouter/service/jsonrpc"
@@ -26,26 +29,28 @@ type StdioClient struct {
 	done          chan struct{}         // client closed signal
 	messages      map[int64]chan []byte // stdout messages channel
 	mu            sync.RWMutex
-	notifications []func(message []byte) // notification handlers
+	notifications []NotificationHandler // notification handlers
+	requests      RequestHandler        // server request handler
 	nmu           sync.RWMutex
-	err           chan error // stderr message
+	wmu           sync.Mutex    // serializes stdin writes
+	nextID        atomic.Int64  // upstream request id sequence
+	routes        requestRoutes // sessions of the requests in flight
+	err           chan error    // stderr message
+	stderrLog     *stderrBuffer // recent stderr lines of the process
+	stderrDone    chan struct{} // closed when stderr is read to the end
+	exited        chan struct{} // closed once the process is waited for
+	tempDir       string        // temporary directory of the process, removed once it exits
+	startedAt     time.Time
 }
 
 // NewStdioClient creates a new StdioClient.
 func NewStdioClient(serverConfig *mcpserver.ServerConfig) (*StdioClient, error) {
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("cmd.exe", "/C", serverConfig.Command)
-	} else {
-		cmd = exec.Command("sh", "-c", serverConfig.Command)
+	// the shell runs in its own process group, its children are killed with it
+	cmd, tempDir, err := newCommand(serverConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create command: %w", err)
 	}
 
-	//cmd := exec.Command(
-	//	"sh",
-	//	"-c",
-	//	serverConfig.Command,
-	//)
-
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
@@ -70,28 +75,43 @@ func NewStdioClient(serverConfig *mcpserver.ServerConfig) (*StdioClient, error)
 		done:         make(chan struct{}),
 		messages:     make(map[int64]chan []byte),
 		err:          make(chan error, 1),
+		stderrLog:    &stderrBuffer{},
+		stderrDone:   make(chan struct{}),
+		exited:       make(chan struct{}),
+		tempDir:      tempDir,
 	}
 
 	// run command
-	if err := cmd.Start(); err != nil {
+	if err := startCommand(cmd, serverConfig.Sandbox); err != nil {
+		if tempDir != "" {
+			os.RemoveAll(tempDir)
+		}
 		return nil, fmt.Errorf("failed to start command: %w", err)
 	}
+	trackProcess(cmd)
+	client.startedAt = time.Now()
 
 	// listen stderr
 	go func() {
+		defer close(client.stderrDone)
+
+		// servers log warnings and progress to stderr too, it only tells why the process exited
+		// or did not answer initialize. The lines are kept for the stderr endpoint, only the first
+		// one telling a cause of failure is logged.
+		logged := false
 		scanner := bufio.NewScanner(stderr)
 		for scanner.Scan() {
 			errmsg := scanner.Text()
-			fmt.Printf("stderr: %s\n", errmsg)
-			// todo: detect error type, error or warning
-			// only error message need to be sent
-			// client.err <- fmt.Errorf("mcp server run failed: %s", errmsg)
-			// client.Close()
-			// return
+			client.stderrLog.add(errmsg)
+
+			if cause := stderrCause(errmsg); cause != "" && !logged {
+				fmt.Printf("stderr of %s tells %s: %s\n", serverConfig.CommandLine(), cause, errmsg)
+				logged = true
+			}
 		}
 
 		if err := scanner.Err(); err != nil {
-			client.err <- fmt.Errorf("stderr scanner error: %w", err)
+			client.fail(fmt.Errorf("stderr scanner error: %w", err))
 			client.Close()
 		}
 	}()
@@ -104,7 +124,7 @@ func NewStdioClient(serverConfig *mcpserver.ServerConfig) (*StdioClient, error)
 	}()
 	<-ready
 
-	fmt.Printf("mcp server running with command: %s\n", serverConfig.Command)
+	fmt.Printf("mcp server running with command: %s\n", serverConfig.CommandLine())
 
 	return client, nil
 }
@@ -138,15 +158,40 @@ func (c *StdioClient) listen() {
 
 			// notification message
 			if !msg.Get("id").Exists() {
+				sessionID, message := c.routes.notification(message)
+
 				c.nmu.RLock()
 				// send notification message to all handlers
 				for _, handler := range c.notifications {
-					handler(message)
+					handler(sessionID, message)
 				}
 				c.nmu.RUnlock()
 				continue
 			}
 
+			// request message initiated by the server
+			if msg.Get("method").Exists() {
+				c.nmu.RLock()
+				handler := c.requests
+				c.nmu.RUnlock()
+
+				// the server request comes with the requests in flight, it is tied to their session
+				sessionID := c.routes.session()
+
+				go func() {
+					response, err := handleServerRequest(handler, sessionID, message)
+					if err != nil {
+						fmt.Printf("failed to build server request response: %v\n", err)
+						return
+					}
+
+					if err := c.write(append(response, '\n')); err != nil {
+						fmt.Printf("failed to write server request response: %v\n", err)
+					}
+				}()
+				continue
+			}
+
 			// not notification message
 			id := msg.Get("id").Int()
 
@@ -168,6 +213,50 @@ func (c *StdioClient) listen() {
 	}
 }
 
+// fail reports an error of the process with the tail of its stderr, the first error is kept until it is read
+func (c *StdioClient) fail(err error) {
+	select {
+	case c.err <- newBackendError(err, c.stderrLog.tail(0)):
+	default:
+	}
+}
+
+// exitError returns the error of a request the exited process did not answer, with the tail of its stderr
+func (c *StdioClient) exitError(message string) error {
+	// the last lines may still be in the pipe
+	select {
+	case <-c.stderrDone:
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	var state *os.ProcessState
+	select {
+	case <-c.exited:
+		state = c.cmd.ProcessState
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	berr := newBackendError(errors.New(message), c.stderrLog.tail(0))
+	berr.Violation = sandboxViolation(c.serverConfig.Sandbox, state, berr.Stderr)
+
+	return berr
+}
+
+// Stderr returns the last n stderr lines of the process
+func (c *StdioClient) Stderr(n int) []string {
+	return c.stderrLog.tail(n)
+}
+
+// Usage returns the resource usage of the process once it has exited
+func (c *StdioClient) Usage() []ProcessUsage {
+	select {
+	case <-c.exited:
+		return []ProcessUsage{processUsage(c.cmd.ProcessState, c.startedAt)}
+	default:
+		return nil
+	}
+}
+
 // Error returns the error message from stderr
 func (c *StdioClient) Error() error {
 	select {
@@ -211,30 +300,70 @@ func (c *StdioClient) Close() error {
 	cmdWaiting := make(chan struct{})
 	go func() {
 		close(cmdWaiting)
-		cmdClosed <- c.cmd.Wait()
+		// Wait closes stderr, it is read to the end first
+		select {
+		case <-c.stderrDone:
+		case <-time.After(5 * time.Second):
+		}
+		err := c.cmd.Wait()
+		untrackProcess(c.cmd)
+		close(c.exited)
+		if c.tempDir != "" {
+			os.RemoveAll(c.tempDir)
+		}
+		cmdClosed <- err
 	}()
 	<-cmdWaiting
 
 	select {
 	case err := <-cmdClosed:
+		// the shell may have left children behind
+		killProcessGroup(c.cmd)
 		return err
 	case <-time.After(5 * time.Second):
-		if err := c.cmd.Process.Kill(); err != nil {
+		if err := killProcessGroup(c.cmd); err != nil {
 			return fmt.Errorf("failed to kill process: %w", err)
 		}
 		return fmt.Errorf("process killed after timeout")
 	}
 }
 
+// closed reports whether the client has been closed
+func (c *StdioClient) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
 // OnNotification adds a notification handler
-func (c *StdioClient) OnNotification(handler func(message []byte)) {
+func (c *StdioClient) OnNotification(handler NotificationHandler) {
 	c.nmu.Lock()
 	c.notifications = append(c.notifications, handler)
 	c.nmu.Unlock()
 }
 
+// OnRequest sets the handler for requests initiated by the server
+func (c *StdioClient) OnRequest(handler RequestHandler) {
+	c.nmu.Lock()
+	c.requests = handler
+	c.nmu.Unlock()
+}
+
+// write writes a message line to stdin
+func (c *StdioClient) write(message []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	_, err := c.stdin.Write(message)
+
+	return err
+}
+
 // SendMessage sends a JSON-RPC message to the MCP server and returns the response
-func (c *StdioClient) SendMessage(message []byte) ([]byte, error) {
+func (c *StdioClient) SendMessage(ctx context.Context, message []byte) ([]byte, error) {
 	// parsed message
 	msg := gjson.ParseBytes(message)
 	if msg.Get("jsonrpc").String() != jsonrpc.JSONRPC_VERSION {
@@ -254,7 +383,8 @@ func (c *StdioClient) SendMessage(message []byte) ([]byte, error) {
 
 	var err error
 
-	message, err = sjson.SetBytes(message, "params._meta", metadata)
+	// keep the client _meta, such as progressToken, and add the auth params
+	message, err = sjson.SetBytes(message, "params._meta.auth", serverParams)
 	if err != nil {
 		return nil, fmt.Errorf("failed to modify message: %w", err)
 	}
@@ -266,11 +396,10 @@ func (c *StdioClient) SendMessage(message []byte) ([]byte, error) {
 		}
 	}
 
-	message = append(message, '\n')
-
 	if !msg.Get("id").Exists() {
 		// notification message
-		if _, err := c.stdin.Write(message); err != nil {
+		message = append(message, '\n')
+		if err := c.write(message); err != nil {
 			return nil, fmt.Errorf("failed to write notification message: %w", err)
 		}
 
@@ -279,8 +408,21 @@ func (c *StdioClient) SendMessage(message []byte) ([]byte, error) {
 		return nil, nil
 	}
 
-	// not notification message
-	id := msg.Get("id").Int()
+	// not notification message, assign an upstream id unique to this backend
+	id := c.nextID.Add(1)
+
+	message, err = rewriteID(message, id)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err = c.routes.add(ctx, id, message)
+	if err != nil {
+		return nil, err
+	}
+	defer c.routes.remove(id)
+
+	message = append(message, '\n')
 
 	// message channel
 	msgch := make(chan []byte, 1)
@@ -295,36 +437,52 @@ func (c *StdioClient) SendMessage(message []byte) ([]byte, error) {
 		c.mu.Unlock()
 	}()
 
-	if _, err := c.stdin.Write(message); err != nil {
+	if err := c.write(message); err != nil {
 		c.Close()
-		return nil, fmt.Errorf("failed to write request message: %w", err)
+		// the process has most likely exited, its stderr tells why
+		return nil, c.exitError(fmt.Sprintf("failed to write request message: %v", err))
 	}
 
 	// fmt.Printf("stdin write request message: %s\n", message)
 
-	timeout := time.After(30 * time.Second)
+	// a timeout fails the request only, the backend keeps running
+	timeout := requestTimeout(c.serverConfig, msg)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
 	// wait for response
 	for {
 		select {
-		case <-timeout:
-			fmt.Println("timeout waiting for response after 30 seconds")
-			c.Close()
-			return nil, fmt.Errorf("timeout waiting for response after 30 seconds")
 		case <-c.done:
 			fmt.Println("client closed with no response")
-			return nil, fmt.Errorf("client closed with no response")
+			return nil, c.exitError("client closed with no response")
 		case err := <-c.err:
 			fmt.Printf("stderr with no response: %s\n", err)
 			return nil, err
+		case <-ctx.Done():
+			c.cancel(id, ctx.Err())
+			// a backend not answering initialize failed to start
+			if msg.Get("method").String() == jsonrpc.MethodInitialize && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, newBackendError(fmt.Errorf("no response to initialize after %s", timeout), c.stderrLog.tail(0))
+			}
+			return nil, abortError(ctx, timeout)
 		case response := <-msgch:
-			return response, nil
+			return restoreID(response, msg.Get("id"))
 		}
 	}
 }
 
+// cancel tells the server to stop working on the request
+func (c *StdioClient) cancel(id int64, reason error) {
+	fmt.Printf("cancel request %d: %v\n", id, reason)
+
+	if err := c.write(append(cancelNotification(id, reason), '\n')); err != nil {
+		fmt.Printf("failed to write cancelled notification: %v\n", err)
+	}
+}
+
 // ForwardMessage forwards a JSON-RPC message to the MCP server and returns the response
-func (c *StdioClient) ForwardMessage(request *jsonrpc.Request) (*jsonrpc.Response, error) {
+func (c *StdioClient) ForwardMessage(ctx context.Context, request *jsonrpc.Request) (*jsonrpc.Response, error) {
 	// fmt.Printf("forward request: %+v\n", request)
 
 	req, err := json.Marshal(request)
@@ -332,7 +490,7 @@ func (c *StdioClient) ForwardMessage(request *jsonrpc.Request) (*jsonrpc.Respons
 		return nil, err
 	}
 
-	res, err := c.SendMessage(req)
+	res, err := c.SendMessage(ctx, req)
 	if err != nil {
 		fmt.Printf("failed to forward message: %v\n", err)
 		return nil, err
@@ -343,8 +501,8 @@ func (c *StdioClient) ForwardMessage(request *jsonrpc.Request) (*jsonrpc.Respons
 		return nil, nil
 	}
 
-	response := &jsonrpc.Response{}
-	if err := json.Unmarshal(res, response); err != nil {
+	response, err := jsonrpc.UnmarshalResponse(res)
+	if err != nil {
 		return nil, err
 	}
 
@@ -354,10 +512,10 @@ func (c *StdioClient) ForwardMessage(request *jsonrpc.Request) (*jsonrpc.Respons
 }
 
 // Initialize initializes the client.
-func (c *StdioClient) Initialize(params *jsonrpc.InitializeParams) (*jsonrpc.InitializeResult, error) {
+func (c *StdioClient) Initialize(ctx context.Context, params *jsonrpc.InitializeParams) (*jsonrpc.InitializeResult, error) {
 	request := jsonrpc.NewRequest(jsonrpc.MethodInitialize, params, 0)
 
-	response, err := c.ForwardMessage(request)
+	response, err := c.ForwardMessage(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -375,10 +533,10 @@ func (c *StdioClient) Initialize(params *jsonrpc.InitializeParams) (*jsonrpc.Ini
 }
 
 // NotificationsInitialized sends the initialized notification to the server.
-func (c *StdioClient) NotificationsInitialized() error {
+func (c *StdioClient) NotificationsInitialized(ctx context.Context) error {
 	request := jsonrpc.NewRequest(jsonrpc.MethodInitializedNotification, nil, nil)
 
-	_, err := c.ForwardMessage(request)
+	_, err := c.ForwardMessage(ctx, request)
 	if err != nil {
 		return err
 	}
@@ -387,10 +545,10 @@ func (c *StdioClient) NotificationsInitialized() error {
 }
 
 // ListTools lists the tools available in the MCP server.
-func (c *StdioClient) ListTools() (*jsonrpc.ListToolsResult, error) {
+func (c *StdioClient) ListTools(ctx context.Context) (*jsonrpc.ListToolsResult, error) {
 	request := jsonrpc.NewRequest(jsonrpc.MethodListTools, nil, 1)
 
-	response, err := c.ForwardMessage(request)
+	response, err := c.ForwardMessage(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -408,10 +566,10 @@ func (c *StdioClient) ListTools() (*jsonrpc.ListToolsResult, error) {
 }
 
 // CallTool calls a tool with the given name and arguments.
-func (c *StdioClient) CallTool(params *jsonrpc.CallToolParams) (*jsonrpc.CallToolResult, error) {
+func (c *StdioClient) CallTool(ctx context.Context, params *jsonrpc.CallToolParams) (*jsonrpc.CallToolResult, error) {
 	request := jsonrpc.NewRequest(jsonrpc.MethodCallTool, params, 1)
 
-	response, err := c.ForwardMessage(request)
+	response, err := c.ForwardMessage(ctx, request)
 	if err != nil {
 		return nil, err
 	}
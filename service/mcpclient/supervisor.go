@@ -0,0 +1,465 @@
+package mcpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	restartBackoffMin = 500 * time.Millisecond
+	restartBackoffMax = 30 * time.Second
+
+	defaultMaxRestarts   = 5
+	defaultRestartWindow = 60 // seconds
+)
+
+// ErrBackendRestarting is returned for the requests in flight when the backend process exits,
+// the supervisor restarts it and the client can keep being used
+var ErrBackendRestarting = errors.New("backend exited, restarting")
+
+// SupervisedClient is a client that restarts its stdio backend process when it exits, with an exponential
+// backoff. The recorded initialize handshake is replayed on the new process, so that downstream clients
+// keep working without reconnecting. It gives up when the backend crashes too often.
+type SupervisedClient struct {
+	serverConfig  *mcpserver.ServerConfig
+	client        *StdioClient
+	ready         chan struct{} // closed when client is running, replaced while restarting
+	err           error         // set when the supervisor gave up
+	mu            sync.RWMutex
+	initRequest   []byte                // recorded initialize request, replayed on restart
+	initialized   []byte                // recorded initialized notification
+	notifications []NotificationHandler // notification handlers
+	requests      RequestHandler        // server request handler
+	nmu           sync.RWMutex
+	done          chan struct{} // client closed signal
+	closeOnce     sync.Once
+}
+
+// NewSupervisedClient starts the stdio backend and supervises it.
+func NewSupervisedClient(serverConfig *mcpserver.ServerConfig) (*SupervisedClient, error) {
+	s := &SupervisedClient{
+		serverConfig: serverConfig,
+		ready:        make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	client, err := s.start()
+	if err != nil {
+		return nil, err
+	}
+
+	s.client = client
+	close(s.ready)
+
+	go s.supervise()
+
+	return s, nil
+}
+
+// start starts a backend process whose messages go to the handlers of the supervisor
+func (s *SupervisedClient) start() (*StdioClient, error) {
+	client, err := NewStdioClient(s.serverConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	client.OnNotification(s.notify)
+	client.OnRequest(s.request)
+
+	return client, nil
+}
+
+// supervise waits for the backend to exit and restarts it, until the supervisor is closed or gives up
+func (s *SupervisedClient) supervise() {
+	maxRestarts := s.serverConfig.MaxRestarts
+	if maxRestarts <= 0 {
+		maxRestarts = defaultMaxRestarts
+	}
+
+	window := time.Duration(s.serverConfig.RestartWindow) * time.Second
+	if window <= 0 {
+		window = defaultRestartWindow * time.Second
+	}
+
+	var crashes []time.Time
+	backoff := restartBackoffMin
+	startedAt := time.Now()
+
+	for {
+		s.mu.RLock()
+		client := s.client
+		s.mu.RUnlock()
+
+		select {
+		case <-s.done:
+			return
+		case <-client.done:
+		}
+
+		s.mu.Lock()
+		s.ready = make(chan struct{})
+		s.mu.Unlock()
+
+		// a backend that ran for the whole window starts over with the shortest backoff
+		if time.Since(startedAt) >= window {
+			backoff = restartBackoffMin
+		}
+
+		for {
+			crashes = recentCrashes(append(crashes, time.Now()), window)
+			if len(crashes) > maxRestarts {
+				s.giveUp(newBackendError(fmt.Errorf("backend crashed %d times in %s, giving up", len(crashes), window), client.Stderr(0)))
+				return
+			}
+
+			fmt.Printf("backend of %s exited, restarting in %s\n", s.serverConfig.CommandLine(), backoff)
+
+			select {
+			case <-s.done:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, restartBackoffMax)
+
+			client, err := s.restart()
+			if err != nil {
+				fmt.Printf("failed to restart backend of %s: %v\n", s.serverConfig.CommandLine(), err)
+				continue
+			}
+
+			s.mu.Lock()
+			s.client = client
+			close(s.ready)
+			s.mu.Unlock()
+			startedAt = time.Now()
+
+			// closed while restarting
+			select {
+			case <-s.done:
+				client.Close()
+				return
+			default:
+			}
+
+			fmt.Printf("backend of %s restarted\n", s.serverConfig.CommandLine())
+			break
+		}
+	}
+}
+
+// recentCrashes drops the crashes older than the window
+func recentCrashes(crashes []time.Time, window time.Duration) []time.Time {
+	recent := crashes[:0]
+	for _, crash := range crashes {
+		if time.Since(crash) < window {
+			recent = append(recent, crash)
+		}
+	}
+
+	return recent
+}
+
+// restart starts a new backend process and replays the recorded initialize handshake on it
+func (s *SupervisedClient) restart() (*StdioClient, error) {
+	client, err := s.start()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	initRequest, initialized := s.initRequest, s.initialized
+	s.mu.RUnlock()
+
+	if initRequest == nil {
+		return client, nil
+	}
+
+	if _, err := client.SendMessage(context.Background(), initRequest); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to replay initialize: %w", err)
+	}
+
+	if initialized != nil {
+		if _, err := client.SendMessage(context.Background(), initialized); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed to replay initialized notification: %w", err)
+		}
+	}
+
+	return client, nil
+}
+
+// giveUp closes the supervisor for good, requests fail with err
+func (s *SupervisedClient) giveUp(err error) {
+	fmt.Printf("backend of %s: %v\n", s.serverConfig.CommandLine(), err)
+
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+
+	s.Close()
+}
+
+// current returns the running backend, waiting for it while it restarts
+func (s *SupervisedClient) current(ctx context.Context) (*StdioClient, error) {
+	s.mu.RLock()
+	ready := s.ready
+	s.mu.RUnlock()
+
+	select {
+	case <-ready:
+	case <-s.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case <-s.done:
+		if err := s.Error(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("client closed")
+	default:
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.client, nil
+}
+
+// closed reports whether the supervisor is closed or gave up
+func (s *SupervisedClient) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// notify sends the notification message to all handlers
+func (s *SupervisedClient) notify(sessionID string, message []byte) {
+	s.nmu.RLock()
+	defer s.nmu.RUnlock()
+
+	for _, handler := range s.notifications {
+		handler(sessionID, message)
+	}
+}
+
+// request passes the server request to the handler
+func (s *SupervisedClient) request(sessionID string, message []byte) ([]byte, error) {
+	s.nmu.RLock()
+	handler := s.requests
+	s.nmu.RUnlock()
+
+	if handler == nil {
+		return nil, fmt.Errorf("no handler for server request")
+	}
+
+	return handler(sessionID, message)
+}
+
+// Error returns the error the supervisor gave up with, or the error reported by the backend
+func (s *SupervisedClient) Error() error {
+	s.mu.RLock()
+	client, err := s.client, s.err
+	s.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	return client.Error()
+}
+
+// Usage returns the resource usage of the backend once it has exited
+func (s *SupervisedClient) Usage() []ProcessUsage {
+	s.mu.RLock()
+	client := s.client
+	s.mu.RUnlock()
+
+	return client.Usage()
+}
+
+// Stderr returns the last n stderr lines of the running backend
+func (s *SupervisedClient) Stderr(n int) []string {
+	s.mu.RLock()
+	client := s.client
+	s.mu.RUnlock()
+
+	return client.Stderr(n)
+}
+
+// Close stops supervising and closes the backend
+func (s *SupervisedClient) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+
+	s.mu.RLock()
+	client := s.client
+	s.mu.RUnlock()
+
+	return client.Close()
+}
+
+// OnNotification adds a notification handler
+func (s *SupervisedClient) OnNotification(handler NotificationHandler) {
+	s.nmu.Lock()
+	s.notifications = append(s.notifications, handler)
+	s.nmu.Unlock()
+}
+
+// OnRequest sets the handler for requests initiated by the server
+func (s *SupervisedClient) OnRequest(handler RequestHandler) {
+	s.nmu.Lock()
+	s.requests = handler
+	s.nmu.Unlock()
+}
+
+// SendMessage sends a JSON-RPC message to the running backend and returns the response
+func (s *SupervisedClient) SendMessage(ctx context.Context, message []byte) ([]byte, error) {
+	client, err := s.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	method := gjson.GetBytes(message, "method").String()
+
+	response, err := client.SendMessage(ctx, message)
+	if err != nil {
+		if client.closed() && ctx.Err() == nil {
+			select {
+			case <-s.done:
+			default:
+				return nil, fmt.Errorf("%w: %w", ErrBackendRestarting, err)
+			}
+		}
+		return nil, err
+	}
+
+	// record the handshake to replay it on restart
+	switch method {
+	case jsonrpc.MethodInitialize:
+		s.mu.Lock()
+		s.initRequest = message
+		s.mu.Unlock()
+	case jsonrpc.MethodInitializedNotification:
+		s.mu.Lock()
+		s.initialized = message
+		s.mu.Unlock()
+	}
+
+	return response, nil
+}
+
+// ForwardMessage forwards a JSON-RPC message to the MCP server and returns the response
+func (s *SupervisedClient) ForwardMessage(ctx context.Context, request *jsonrpc.Request) (*jsonrpc.Response, error) {
+	req, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.SendMessage(ctx, req)
+	if err != nil {
+		fmt.Printf("failed to forward message: %v\n", err)
+		return nil, err
+	}
+
+	// notification message with no response
+	if res == nil {
+		return nil, nil
+	}
+
+	response, err := jsonrpc.UnmarshalResponse(res)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// Initialize initializes the client.
+func (s *SupervisedClient) Initialize(ctx context.Context, params *jsonrpc.InitializeParams) (*jsonrpc.InitializeResult, error) {
+	request := jsonrpc.NewRequest(jsonrpc.MethodInitialize, params, 0)
+
+	response, err := s.ForwardMessage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	result := &jsonrpc.InitializeResult{}
+	if err := response.UnmarshalResult(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// NotificationsInitialized sends the initialized notification to the server.
+func (s *SupervisedClient) NotificationsInitialized(ctx context.Context) error {
+	request := jsonrpc.NewRequest(jsonrpc.MethodInitializedNotification, nil, nil)
+
+	_, err := s.ForwardMessage(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListTools lists the tools available in the MCP server.
+func (s *SupervisedClient) ListTools(ctx context.Context) (*jsonrpc.ListToolsResult, error) {
+	request := jsonrpc.NewRequest(jsonrpc.MethodListTools, nil, 1)
+
+	response, err := s.ForwardMessage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	result := &jsonrpc.ListToolsResult{}
+	if err := response.UnmarshalResult(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CallTool calls a tool with the given name and arguments.
+func (s *SupervisedClient) CallTool(ctx context.Context, params *jsonrpc.CallToolParams) (*jsonrpc.CallToolResult, error) {
+	request := jsonrpc.NewRequest(jsonrpc.MethodCallTool, params, 1)
+
+	response, err := s.ForwardMessage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	result := &jsonrpc.CallToolResult{}
+	if err := response.UnmarshalResult(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
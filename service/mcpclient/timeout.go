@@ -0,0 +1,51 @@
+package mcpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+	"github.com/tidwall/gjson"
+)
+
+// defaultTimeout is the request timeout of servers with no timeout configured
+const defaultTimeout = 30 * time.Second
+
+// requestTimeout returns the timeout of a request: the timeout of the tool for tool calls, else the timeout of the server.
+// The client may ask for another timeout in seconds with _meta.timeout, up to the max timeout of the server.
+func requestTimeout(serverConfig *mcpserver.ServerConfig, msg gjson.Result) time.Duration {
+	timeout := defaultTimeout
+	if serverConfig.Timeout > 0 {
+		timeout = time.Duration(serverConfig.Timeout) * time.Second
+	}
+
+	if msg.Get("method").String() == jsonrpc.MethodCallTool {
+		if seconds := serverConfig.ToolTimeouts[msg.Get("params.name").String()]; seconds > 0 {
+			timeout = time.Duration(seconds) * time.Second
+		}
+	}
+
+	if override := msg.Get("params._meta.timeout"); override.Exists() && serverConfig.MaxTimeout > 0 {
+		requested := time.Duration(override.Float() * float64(time.Second))
+		if max := time.Duration(serverConfig.MaxTimeout) * time.Second; requested > max {
+			requested = max
+		}
+		if requested > 0 {
+			timeout = requested
+		}
+	}
+
+	return timeout
+}
+
+// abortError returns the error of a request given up before its response, because it timed out or was cancelled
+func abortError(ctx context.Context, timeout time.Duration) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timeout waiting for response after %s: %w", timeout, ctx.Err())
+	}
+
+	return ctx.Err()
+}
@@ -0,0 +1,47 @@
+package mcpclient
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// ProcessUsage is the resource usage of an exited backend process
+type ProcessUsage struct {
+	Pid        int
+	Uptime     time.Duration
+	UserTime   time.Duration
+	SystemTime time.Duration
+	MaxRSS     int64 // KB
+}
+
+// String returns the usage in a log friendly form
+func (u ProcessUsage) String() string {
+	return fmt.Sprintf("pid %d, uptime %s, user %s, system %s, max rss %d KB",
+		u.Pid, u.Uptime.Round(time.Second), u.UserTime, u.SystemTime, u.MaxRSS)
+}
+
+// usageReporter is implemented by clients running backend processes
+type usageReporter interface {
+	Usage() []ProcessUsage
+}
+
+// Usage returns the resource usage of the exited backend processes of the client
+func Usage(client Client) []ProcessUsage {
+	if reporter, ok := client.(usageReporter); ok {
+		return reporter.Usage()
+	}
+
+	return nil
+}
+
+// processUsage returns the usage of an exited process started at startedAt
+func processUsage(state *os.ProcessState, startedAt time.Time) ProcessUsage {
+	return ProcessUsage{
+		Pid:        state.Pid(),
+		Uptime:     time.Since(startedAt),
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+		MaxRSS:     maxRSS(state),
+	}
+}
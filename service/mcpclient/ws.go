@@ -0,0 +1,417 @@
+package mcpclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"golang.org/x/net/websocket"
+)
+
+// WSProtocol is the websocket subprotocol of MCP
+const WSProtocol = "mcp"
+
+// WSClient is a client that uses a WebSocket connection to communicate with the backend mcp server,
+// each frame carries one JSON-RPC message.
+type WSClient struct {
+	serverConfig  *mcpserver.ServerConfig
+	conn          *websocket.Conn
+	done          chan struct{}         // client closed signal
+	messages      map[int64]chan []byte // response messages channel
+	mu            sync.RWMutex
+	notifications []NotificationHandler // notification handlers
+	requests      RequestHandler        // server request handler
+	nmu           sync.RWMutex
+	wmu           sync.Mutex    // serializes frame writes
+	nextID        atomic.Int64  // upstream request id sequence
+	routes        requestRoutes // sessions of the requests in flight
+	err           chan error    // error channel
+}
+
+// NewWSClient creates a new WSClient.
+func NewWSClient(serverConfig *mcpserver.ServerConfig) (*WSClient, error) {
+	// the origin is required by the handshake, use the server url with its http scheme
+	origin, err := url.Parse(serverConfig.ServerURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server url: %w", err)
+	}
+	if origin.Scheme == "wss" {
+		origin.Scheme = "https"
+	} else {
+		origin.Scheme = "http"
+	}
+
+	config, err := websocket.NewConfig(serverConfig.ServerURL, origin.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid server url: %w", err)
+	}
+	config.Protocol = []string{WSProtocol}
+
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to websocket: %w", err)
+	}
+
+	client := &WSClient{
+		serverConfig: serverConfig,
+		conn:         conn,
+		done:         make(chan struct{}),
+		messages:     make(map[int64]chan []byte),
+		err:          make(chan error, 1),
+	}
+
+	// listen frames
+	go client.listen()
+
+	fmt.Printf("mcp server connected to: %s\n", serverConfig.ServerURL)
+
+	return client, nil
+}
+
+// listen for messages from the backend mcp server.
+func (c *WSClient) listen() {
+	defer c.Close()
+
+	for {
+		var message []byte
+		if err := websocket.Message.Receive(c.conn, &message); err != nil {
+			if err != io.EOF && !c.closed() {
+				fmt.Printf("failed to read message: %v\n", err)
+			}
+			return
+		}
+
+		c.handle(message)
+	}
+}
+
+// handle dispatches a message received from the server
+func (c *WSClient) handle(message []byte) {
+	msg := gjson.ParseBytes(message)
+	if msg.Get("jsonrpc").String() != jsonrpc.JSONRPC_VERSION {
+		fmt.Printf("invalid response message: %s\n", message)
+		return
+	}
+
+	// notification message
+	if !msg.Get("id").Exists() {
+		sessionID, message := c.routes.notification(message)
+
+		c.nmu.RLock()
+		for _, handler := range c.notifications {
+			handler(sessionID, message)
+		}
+		c.nmu.RUnlock()
+		return
+	}
+
+	// request message initiated by the server, answered on the connection
+	if msg.Get("method").Exists() {
+		c.nmu.RLock()
+		handler := c.requests
+		c.nmu.RUnlock()
+
+		// the server request comes with the requests in flight, it is tied to their session
+		sessionID := c.routes.session()
+
+		go func() {
+			response, err := handleServerRequest(handler, sessionID, message)
+			if err != nil {
+				fmt.Printf("failed to build server request response: %v\n", err)
+				return
+			}
+
+			if err := c.write(response); err != nil {
+				fmt.Printf("failed to write server request response: %v\n", err)
+			}
+		}()
+		return
+	}
+
+	// result or error message
+	id := msg.Get("id").Int()
+
+	c.mu.RLock()
+	msgch, ok := c.messages[id]
+	c.mu.RUnlock()
+
+	if !ok {
+		// response message without corresponding request
+		fmt.Printf("isolated response message: %s\n", message)
+		return
+	}
+
+	msgch <- message
+}
+
+// Error returns the error message
+func (c *WSClient) Error() error {
+	select {
+	case err := <-c.err:
+		return err
+	default:
+		return nil
+	}
+}
+
+// Close client
+func (c *WSClient) Close() error {
+	c.mu.Lock()
+	select {
+	case <-c.done:
+		c.mu.Unlock()
+		return nil
+	default:
+		close(c.done)
+		c.mu.Unlock()
+	}
+
+	return c.conn.Close()
+}
+
+// closed reports whether the client has been closed
+func (c *WSClient) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// OnNotification adds a notification handler
+func (c *WSClient) OnNotification(handler NotificationHandler) {
+	c.nmu.Lock()
+	c.notifications = append(c.notifications, handler)
+	c.nmu.Unlock()
+}
+
+// OnRequest sets the handler for requests initiated by the server
+func (c *WSClient) OnRequest(handler RequestHandler) {
+	c.nmu.Lock()
+	c.requests = handler
+	c.nmu.Unlock()
+}
+
+// write sends a message frame to the server
+func (c *WSClient) write(message []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	return websocket.Message.Send(c.conn, string(message))
+}
+
+// SendMessage sends a JSON-RPC message to the MCP server and returns the response
+func (c *WSClient) SendMessage(ctx context.Context, message []byte) ([]byte, error) {
+	fmt.Printf("sending message: %s\n", message)
+
+	// parsed message
+	msg := gjson.ParseBytes(message)
+	if msg.Get("jsonrpc").String() != jsonrpc.JSONRPC_VERSION {
+		return nil, fmt.Errorf("invalid request message: %s", message)
+	}
+
+	serverParams := map[string]interface{}{}
+	if c.serverConfig.ServerParams != "" {
+		if err := json.Unmarshal([]byte(c.serverConfig.ServerParams), &serverParams); err != nil {
+			fmt.Printf("failed to unmarshal server params: %v\n", err)
+		}
+	}
+
+	metadata := map[string]interface{}{
+		"auth": serverParams,
+	}
+
+	var err error
+
+	// keep the client _meta, such as progressToken, and add the auth params
+	message, err = sjson.SetBytes(message, "params._meta.auth", serverParams)
+	if err != nil {
+		return nil, fmt.Errorf("failed to modify message: %w", err)
+	}
+
+	if msg.Get("method").String() == "initialize" {
+		message, err = sjson.SetBytes(message, "params.capabilities.experimental", metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to modify initialize message: %w", err)
+		}
+	}
+
+	if !msg.Get("id").Exists() {
+		// notification message
+		if err := c.write(message); err != nil {
+			return nil, fmt.Errorf("failed to write notification message: %w", err)
+		}
+
+		fmt.Printf("sent notification message: %s\n", message)
+
+		return nil, nil
+	}
+
+	// not notification message, assign an upstream id unique to this backend
+	id := c.nextID.Add(1)
+
+	message, err = rewriteID(message, id)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err = c.routes.add(ctx, id, message)
+	if err != nil {
+		return nil, err
+	}
+	defer c.routes.remove(id)
+
+	// message channel
+	msgch := make(chan []byte, 1)
+
+	c.mu.Lock()
+	c.messages[id] = msgch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.messages, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(message); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to write request message: %w", err)
+	}
+
+	// a timeout fails the request only, the backend keeps running
+	timeout := requestTimeout(c.serverConfig, msg)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// wait for response
+	select {
+	case <-c.done:
+		fmt.Println("client closed with no response")
+		return nil, fmt.Errorf("client closed with no response")
+	case <-ctx.Done():
+		c.cancel(id, ctx.Err())
+		return nil, abortError(ctx, timeout)
+	case response := <-msgch:
+		return restoreID(response, msg.Get("id"))
+	}
+}
+
+// cancel tells the server to stop working on the request
+func (c *WSClient) cancel(id int64, reason error) {
+	fmt.Printf("cancel request %d: %v\n", id, reason)
+
+	if err := c.write(cancelNotification(id, reason)); err != nil {
+		fmt.Printf("failed to write cancelled notification: %v\n", err)
+	}
+}
+
+// ForwardMessage forwards a JSON-RPC message to the MCP server and returns the response
+func (c *WSClient) ForwardMessage(ctx context.Context, request *jsonrpc.Request) (*jsonrpc.Response, error) {
+	req, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.SendMessage(ctx, req)
+	if err != nil {
+		fmt.Printf("failed to forward message: %v\n", err)
+		return nil, err
+	}
+
+	// notification message with no response
+	if res == nil {
+		return nil, nil
+	}
+
+	response, err := jsonrpc.UnmarshalResponse(res)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// Initialize initializes the client.
+func (c *WSClient) Initialize(ctx context.Context, params *jsonrpc.InitializeParams) (*jsonrpc.InitializeResult, error) {
+	request := jsonrpc.NewRequest(jsonrpc.MethodInitialize, params, 0)
+
+	response, err := c.ForwardMessage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	result := &jsonrpc.InitializeResult{}
+	if err := response.UnmarshalResult(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// NotificationsInitialized sends the initialized notification to the server.
+func (c *WSClient) NotificationsInitialized(ctx context.Context) error {
+	request := jsonrpc.NewRequest(jsonrpc.MethodInitializedNotification, nil, nil)
+
+	_, err := c.ForwardMessage(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListTools lists the tools available in the MCP server.
+func (c *WSClient) ListTools(ctx context.Context) (*jsonrpc.ListToolsResult, error) {
+	request := jsonrpc.NewRequest(jsonrpc.MethodListTools, nil, 1)
+
+	response, err := c.ForwardMessage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	result := &jsonrpc.ListToolsResult{}
+	if err := response.UnmarshalResult(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CallTool calls a tool with the given name and arguments.
+func (c *WSClient) CallTool(ctx context.Context, params *jsonrpc.CallToolParams) (*jsonrpc.CallToolResult, error) {
+	request := jsonrpc.NewRequest(jsonrpc.MethodCallTool, params, 1)
+
+	response, err := c.ForwardMessage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	result := &jsonrpc.CallToolResult{}
+	if err := response.UnmarshalResult(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
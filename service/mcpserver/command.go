@@ -1,5 +1,7 @@
 package mcpserver
 
+import "strings"
+
 // GetServerCommand returns the command for the given key
 func GetServerCommand(key string) string {
 	config := GetServerConfig(key)
@@ -9,3 +11,12 @@ func GetServerCommand(key string) string {
 
 	return config.Command
 }
+
+// CommandLine returns the command of the server with its args, it identifies the backend processes of the server
+func (c *ServerConfig) CommandLine() string {
+	if len(c.Args) == 0 {
+		return c.Command
+	}
+
+	return c.Command + " " + strings.Join(c.Args, " ")
+}
@@ -10,10 +10,14 @@ import (
 	"net/http"
 
 	"github.com/chatmcp/mcprouter/model"
+	"github.com/chatmcp/mcprouter/util"
 	"github.com/spf13/viper"
 	"github.com/tidwall/gjson"
 )
 
+// ServerTypeComposite is the type of the servers combining the servers of other keys
+const ServerTypeComposite = "composite"
+
 // ServerConfig is the config for the remote mcp server
 type ServerConfig struct {
 	ServerUUID       string `json:"server_uuid,omitempty" mapstructure:"server_uuid,omitempty"`
@@ -26,6 +30,101 @@ type ServerConfig struct {
 	ServerType       string `json:"server_type,omitempty" mapstructure:"server_type,omitempty"`
 	ServerURL        string `json:"server_url,omitempty" mapstructure:"server_url,omitempty"`
 	ServerParams     string `json:"server_params,omitempty" mapstructure:"server_params,omitempty"`
+
+	// stdio servers given args run command with them directly, a command with no args is a command line
+	// run by the shell, as is any command when shell is set. The args of a shell command are its positional
+	// parameters. A command line run by the shell without shell set is deprecated.
+	// Env values may use {{name}} placeholders, replaced with the server params.
+	Args  []string          `json:"args,omitempty" mapstructure:"args,omitempty"`
+	Env   map[string]string `json:"env,omitempty" mapstructure:"env,omitempty"`
+	Cwd   string            `json:"cwd,omitempty" mapstructure:"cwd,omitempty"`
+	Shell bool              `json:"shell,omitempty" mapstructure:"shell,omitempty"` // run command as a shell script
+
+	// process pool for shared stdio servers, enabled when max_instances is greater than 1
+	MinInstances     int    `json:"min_instances,omitempty" mapstructure:"min_instances,omitempty"`
+	MaxInstances     int    `json:"max_instances,omitempty" mapstructure:"max_instances,omitempty"`
+	PoolStrategy     string `json:"pool_strategy,omitempty" mapstructure:"pool_strategy,omitempty"`           // least_busy or round_robin
+	ScaleUpThreshold int    `json:"scale_up_threshold,omitempty" mapstructure:"scale_up_threshold,omitempty"` // in-flight requests per instance
+	ScaleDownIdle    int    `json:"scale_down_idle,omitempty" mapstructure:"scale_down_idle,omitempty"`       // seconds
+	Stateful         bool   `json:"stateful,omitempty" mapstructure:"stateful,omitempty"`                     // pin sessions to one instance
+
+	// request timeouts in seconds, a request may ask for its own timeout with _meta.timeout up to max_timeout
+	Timeout      int            `json:"timeout,omitempty" mapstructure:"timeout,omitempty"`
+	ToolTimeouts map[string]int `json:"tool_timeouts,omitempty" mapstructure:"tool_timeouts,omitempty"` // by tool name
+	MaxTimeout   int            `json:"max_timeout,omitempty" mapstructure:"max_timeout,omitempty"`
+
+	// crashed stdio servers are restarted, up to max_restarts times within restart_window seconds
+	MaxRestarts   int `json:"max_restarts,omitempty" mapstructure:"max_restarts,omitempty"`
+	RestartWindow int `json:"restart_window,omitempty" mapstructure:"restart_window,omitempty"`
+
+	// shared clients not used for idle_ttl seconds are closed, unless the server is kept warm
+	IdleTTL  int  `json:"idle_ttl,omitempty" mapstructure:"idle_ttl,omitempty"`
+	KeepWarm bool `json:"keep_warm,omitempty" mapstructure:"keep_warm,omitempty"`
+
+	// composite servers expose the tools, prompts and resources of their member server keys, named
+	// with the prefix of their member and the separator, such as github__create_issue.
+	// The prefix of a member is its key unless set in prefixes, prefixes must not contain the separator.
+	Members   []string          `json:"members,omitempty" mapstructure:"members,omitempty"`
+	Separator string            `json:"separator,omitempty" mapstructure:"separator,omitempty"` // default __
+	Prefixes  map[string]string `json:"prefixes,omitempty" mapstructure:"prefixes,omitempty"`   // by member key
+
+	// execution settings of stdio servers, the [sandbox] section applies when not set
+	Sandbox *SandboxConfig `json:"sandbox,omitempty" mapstructure:"sandbox,omitempty"`
+}
+
+// SandboxConfig is the execution settings of a stdio server process
+type SandboxConfig struct {
+	EnvAllowlist []string `json:"env_allowlist,omitempty" mapstructure:"env_allowlist,omitempty"` // environment variables passed to the server
+	WorkDir      string   `json:"work_dir,omitempty" mapstructure:"work_dir,omitempty"`           // wins over the cwd of the server
+	TempDir      bool     `json:"temp_dir,omitempty" mapstructure:"temp_dir,omitempty"`           // home of its own, the working directory when no work_dir or cwd is set
+	CPUSeconds   int      `json:"cpu_seconds,omitempty" mapstructure:"cpu_seconds,omitempty"`
+	MemoryMB     int      `json:"memory_mb,omitempty" mapstructure:"memory_mb,omitempty"` // address space
+	OpenFiles    int      `json:"open_files,omitempty" mapstructure:"open_files,omitempty"`
+	NoNewPrivs   bool     `json:"no_new_privs,omitempty" mapstructure:"no_new_privs,omitempty"`
+	UID          int      `json:"uid,omitempty" mapstructure:"uid,omitempty"`
+	GID          int      `json:"gid,omitempty" mapstructure:"gid,omitempty"`
+	Namespaces   []string `json:"namespaces,omitempty" mapstructure:"namespaces,omitempty"` // linux namespaces: user, pid, net, ipc, uts, mount
+}
+
+// Composite reports whether the server combines the servers of other keys
+func (c *ServerConfig) Composite() bool {
+	return c.ServerType == ServerTypeComposite
+}
+
+// Runnable reports whether the config has a command, a server url or members to connect to
+func (c *ServerConfig) Runnable() bool {
+	return c.Command != "" || c.ServerURL != "" || (c.Composite() && len(c.Members) > 0)
+}
+
+// defaultSandbox returns the sandbox of the [sandbox] section, nil when not configured
+func defaultSandbox() *SandboxConfig {
+	if !viper.IsSet("sandbox") {
+		return nil
+	}
+
+	sandbox := &SandboxConfig{}
+	if err := viper.UnmarshalKey("sandbox", sandbox); err != nil {
+		log.Printf("get sandbox config failed: %v\n", err)
+		return nil
+	}
+
+	return sandbox
+}
+
+// untrustedSandbox returns the sandbox of the servers of remote and database configs: the [sandbox] section
+// when configured, otherwise a restrictive one, so that they never run unconfined
+func untrustedSandbox() *SandboxConfig {
+	if sandbox := defaultSandbox(); sandbox != nil {
+		return sandbox
+	}
+
+	return &SandboxConfig{
+		TempDir:    true,
+		CPUSeconds: 600,
+		MemoryMB:   2048,
+		OpenFiles:  1024,
+		NoNewPrivs: true,
+	}
 }
 
 // GetServerConfig returns the config for the given key
@@ -34,14 +133,21 @@ func GetServerConfig(key string) *ServerConfig {
 	err := viper.UnmarshalKey(fmt.Sprintf("mcp_servers.%s", key), config)
 	log.Printf("get server config: %s from local env: %+v, with error: %v\n", key, config, err)
 
-	if (config.Command == "" && config.ServerURL == "") && viper.GetBool("app.use_db") {
+	// viper lowercases keys, env names are read from the config file with their case
+	if len(config.Env) > 0 {
+		if env := util.GetRawStringMapString(fmt.Sprintf("mcp_servers.%s.env", key)); len(env) > 0 {
+			config.Env = env
+		}
+	}
+
+	if !config.Runnable() && viper.GetBool("app.use_db") {
 		config, err = getDBServerConfig(key)
 		if err != nil {
 			log.Printf("get db config failed: %v\n", err)
 		}
 	}
 
-	if config == nil || (config.Command == "" && config.ServerURL == "") {
+	if config == nil || !config.Runnable() {
 		log.Printf("get local config failed: %v, try to get remote config\n", err)
 
 		config, err = getRemoteServerConfig(key)
@@ -52,6 +158,10 @@ func GetServerConfig(key string) *ServerConfig {
 		}
 	}
 
+	if config.Sandbox == nil {
+		config.Sandbox = defaultSandbox()
+	}
+
 	return config
 }
 
@@ -67,7 +177,7 @@ func getDBServerConfig(key string) (*ServerConfig, error) {
 		return nil, err
 	}
 
-	return &ServerConfig{
+	config := &ServerConfig{
 		ServerUUID:       server.UUID,
 		ServerName:       server.Name,
 		ServerConfigName: server.ConfigName,
@@ -78,7 +188,30 @@ func getDBServerConfig(key string) (*ServerConfig, error) {
 		ServerType:       "rest",
 		ServerURL:        server.ServerURL,
 		ServerParams:     "",
-	}, nil
+	}
+
+	// stdio servers are stored with their command, args and env
+	if server.ServerURL == "" && server.Command != "" {
+		config.ServerType = ""
+		config.Command = server.Command
+		config.Cwd = server.Cwd
+		config.Sandbox = untrustedSandbox()
+
+		if server.Args != "" {
+			if err := json.Unmarshal([]byte(server.Args), &config.Args); err != nil {
+				return nil, fmt.Errorf("invalid args of server %s: %w", key, err)
+			}
+		}
+		if server.Env != "" {
+			if err := json.Unmarshal([]byte(server.Env), &config.Env); err != nil {
+				return nil, fmt.Errorf("invalid env of server %s: %w", key, err)
+			}
+		}
+
+		config.CommandHash = fmt.Sprintf("%x", md5.Sum([]byte(config.CommandLine())))
+	}
+
+	return config, nil
 }
 
 // getRemoteServerConfig returns the config for the given key from the remote API
@@ -118,8 +251,11 @@ func getRemoteServerConfig(key string) (*ServerConfig, error) {
 		return nil, err
 	}
 
+	// remote configs cannot loosen the sandbox of the router
+	config.Sandbox = untrustedSandbox()
+
 	if config.Command != "" && config.CommandHash == "" {
-		config.CommandHash = fmt.Sprintf("%x", md5.Sum([]byte(config.Command)))
+		config.CommandHash = fmt.Sprintf("%x", md5.Sum([]byte(config.CommandLine())))
 	}
 
 	return config, nil
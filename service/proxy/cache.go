@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/chatmcp/mcprouter/util"
@@ -12,7 +13,8 @@ import (
 )
 
 const (
-	proxyInfoKey = "pi_%s"
+	proxyInfoKey   = "pi_%s"
+	sessionNodeKey = "sn_%s"
 )
 
 // 获取Redis操作接口
@@ -90,3 +92,73 @@ func DeleteProxyInfo(sessionID string) error {
 
 	return nil
 }
+
+// NodeURL returns the url other replicas reach this one at, sessions are only routed between replicas when it is set
+func NodeURL() string {
+	return strings.TrimSuffix(viper.GetString("proxy_server.node_url"), "/")
+}
+
+// StoreSessionNode records this replica as the owner of the session
+func StoreSessionNode(sessionID string) error {
+	nodeURL := NodeURL()
+	if nodeURL == "" {
+		return nil
+	}
+
+	ctx, cancel := getRedisContext()
+	defer cancel()
+
+	handler, err := getRedisHandler()
+	if err != nil {
+		return err
+	}
+
+	cacheKey := fmt.Sprintf(sessionNodeKey, sessionID)
+	expires := 30 * 24 * time.Hour // 30 days, as the proxy info
+
+	return handler.Set(ctx, cacheKey, nodeURL, expires).Err()
+}
+
+// GetSessionNode gets the url of the replica owning the session, empty when it is not known
+func GetSessionNode(sessionID string) string {
+	if NodeURL() == "" {
+		return ""
+	}
+
+	ctx, cancel := getRedisContext()
+	defer cancel()
+
+	handler, err := getRedisHandler()
+	if err != nil {
+		return ""
+	}
+
+	cacheKey := fmt.Sprintf(sessionNodeKey, sessionID)
+
+	nodeURL, err := handler.Get(ctx, cacheKey).Result()
+	if err != nil {
+		return ""
+	}
+
+	return nodeURL
+}
+
+// DeleteSessionNode deletes the owner of the session
+func DeleteSessionNode(sessionID string) error {
+	if NodeURL() == "" {
+		return nil
+	}
+
+	ctx, cancel := getRedisContext()
+	defer cancel()
+
+	handler, err := getRedisHandler()
+	if err != nil {
+		return err
+	}
+
+	cacheKey := fmt.Sprintf(sessionNodeKey, sessionID)
+	handler.Del(ctx, cacheKey)
+
+	return nil
+}
@@ -1,30 +1,59 @@
 package proxy
 
 import (
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/chatmcp/mcprouter/service/jsonrpc"
 	"github.com/chatmcp/mcprouter/service/mcpclient"
+	"github.com/chatmcp/mcprouter/service/mcpserver"
 	"github.com/labstack/echo/v4"
+	"github.com/tidwall/gjson"
 )
 
+// clientEntry is a shared client in the clients store, with the config of its server and its last activity
+type clientEntry struct {
+	client       mcpclient.Client
+	serverConfig *mcpserver.ServerConfig
+	usedAt       atomic.Int64
+}
+
+// idle reports whether the client has not been used for its ttl, clients of keep warm servers are never idle
+func (e *clientEntry) idle(ttl time.Duration) bool {
+	if e.serverConfig != nil {
+		if e.serverConfig.KeepWarm {
+			return false
+		}
+		if e.serverConfig.IdleTTL > 0 {
+			ttl = time.Duration(e.serverConfig.IdleTTL) * time.Second
+		}
+	}
+
+	return ttl > 0 && time.Since(time.Unix(0, e.usedAt.Load())) > ttl
+}
+
 // SSEContext is the context for SSE request
 type SSEContext struct {
 	echo.Context
-	sessions *sync.Map // sessions store
-	clients  *sync.Map // clients store
+	sessions *sync.Map    // sessions store
+	clients  *sync.Map    // clients store
+	draining *atomic.Bool // set once the server is shutting down
 }
 
 // createSSEMiddleware will create a middleware for http request
-func createSSEMiddleware(sessions *sync.Map, clients *sync.Map) echo.MiddlewareFunc {
+func createSSEMiddleware(sessions *sync.Map, clients *sync.Map, draining *atomic.Bool) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			ctx := &SSEContext{
 				Context:  c,
 				sessions: sessions,
 				clients:  clients,
+				draining: draining,
 			}
 
 			return next(ctx)
@@ -41,6 +70,20 @@ func GetSSEContext(c echo.Context) *SSEContext {
 	return nil
 }
 
+// Detach returns a context over the stores of the server, for use after the request is done
+func (c *SSEContext) Detach() *SSEContext {
+	return &SSEContext{
+		sessions: c.sessions,
+		clients:  c.clients,
+		draining: c.draining,
+	}
+}
+
+// Draining reports whether the server is shutting down, no new session is accepted then
+func (c *SSEContext) Draining() bool {
+	return c.draining != nil && c.draining.Load()
+}
+
 // GetSession returns the session from the sessions store
 func (c *SSEContext) GetSession(key string) *SSESession {
 	if session, ok := c.sessions.Load(key); ok {
@@ -57,18 +100,113 @@ func (c *SSEContext) StoreSession(key string, session *SSESession) {
 
 // DeleteSession deletes the session from the sessions store
 func (c *SSEContext) DeleteSession(key string) {
+	if session := c.GetSession(key); session != nil {
+		if entry := c.loadClient(session.Key()); entry != nil {
+			mcpclient.ReleaseSession(entry.client, key)
+		}
+
+		if err := DeleteSessionNode(key); err != nil {
+			fmt.Printf("failed to delete node of session %s: %v\n", key, err)
+		}
+	}
+
 	c.sessions.Delete(key)
 }
 
-// StoreClient stores the client in the clients store
-func (c *SSEContext) StoreClient(key string, client mcpclient.Client) {
-	c.clients.Store(key, client)
+// CloseSession closes the session and releases its dedicated client. The shared client of its server key
+// stays warm for the next session, the idle reaper closes it once no session uses it.
+func (c *SSEContext) CloseSession(sessionID string) {
+	if session := c.GetSession(sessionID); session != nil {
+		session.Close()
+	}
+	c.DeleteSession(sessionID)
+
+	if err := DeleteProxyInfo(sessionID); err != nil {
+		fmt.Printf("failed to delete proxy info for session %s: %v\n", sessionID, err)
+	}
+}
+
+// BroadcastMessage sends the message to all sessions using the backend of the given server key
+func (c *SSEContext) BroadcastMessage(key string, message string) {
+	c.sessions.Range(func(_, value any) bool {
+		if session := value.(*SSESession); session.Uses(key) {
+			session.SendMessage(message)
+		}
+		return true
+	})
+}
+
+// RouteNotification sends a notification of the shared client of the server key to the sessions it is meant for.
+// List changes go to all sessions and resource updates to the subscribed sessions, other notifications, such as
+// progress and logs, go to the session of the request they are about, they are dropped when there is none.
+func (c *SSEContext) RouteNotification(key string, sessionID string, message string) {
+	method := gjson.Get(message, "method").String()
+
+	switch {
+	case strings.HasSuffix(method, "/list_changed"):
+		c.BroadcastMessage(key, message)
+	case method == jsonrpc.MethodResourceUpdated:
+		uri := gjson.Get(message, "params.uri").String()
+		c.sessions.Range(func(_, value any) bool {
+			if session := value.(*SSESession); session.Uses(key) && session.Subscribed(uri) {
+				session.SendMessage(message)
+			}
+			return true
+		})
+	case sessionID != "":
+		if session := c.GetSession(sessionID); session != nil && session.Uses(key) {
+			session.SendMessage(message)
+		}
+	default:
+		fmt.Printf("dropping notification of %s not tied to a session: %s\n", key, message)
+	}
+}
+
+// HasSessions reports whether any session uses the backend of the given server key
+func (c *SSEContext) HasSessions(key string) bool {
+	found := false
+	c.sessions.Range(func(_, value any) bool {
+		found = value.(*SSESession).Uses(key)
+		return !found
+	})
+
+	return found
 }
 
-// GetClient returns the client from the clients store
+// StoreClient stores the client of the server in the clients store
+func (c *SSEContext) StoreClient(key string, client mcpclient.Client, serverConfig *mcpserver.ServerConfig) {
+	entry := &clientEntry{
+		client:       client,
+		serverConfig: serverConfig,
+	}
+	entry.usedAt.Store(time.Now().UnixNano())
+
+	c.clients.Store(key, entry)
+}
+
+// GetClient returns the client from the clients store and marks it as used
 func (c *SSEContext) GetClient(key string) mcpclient.Client {
-	if client, ok := c.clients.Load(key); ok {
-		return client.(mcpclient.Client)
+	if entry := c.loadClient(key); entry != nil {
+		entry.usedAt.Store(time.Now().UnixNano())
+		return entry.client
+	}
+
+	return nil
+}
+
+// PeekClient returns the client from the clients store without marking it as used
+func (c *SSEContext) PeekClient(key string) mcpclient.Client {
+	if entry := c.loadClient(key); entry != nil {
+		return entry.client
+	}
+
+	return nil
+}
+
+// loadClient returns the entry of the client from the clients store
+func (c *SSEContext) loadClient(key string) *clientEntry {
+	if entry, ok := c.clients.Load(key); ok {
+		return entry.(*clientEntry)
 	}
 
 	return nil
@@ -76,28 +214,23 @@ func (c *SSEContext) GetClient(key string) mcpclient.Client {
 
 // DeleteClient deletes the client from the clients store
 func (c *SSEContext) DeleteClient(key string) {
-	if client, ok := c.clients.Load(key); ok {
-		client.(mcpclient.Client).Close()
+	if entry := c.loadClient(key); entry != nil {
+		entry.client.Close()
 	}
 
 	c.clients.Delete(key)
 }
 
-// GetJSONRPCRequest returns the JSON-RPC request from the request body
-func (c *SSEContext) GetJSONRPCRequest() (*jsonrpc.Request, error) {
+// GetJSONRPCRequests returns the JSON-RPC requests from the request body, batch reports whether they came in a batch
+func (c *SSEContext) GetJSONRPCRequests() (requests []*jsonrpc.Request, batch bool, err error) {
 	req := c.Request()
 
 	body, err := io.ReadAll(req.Body)
 	if err != nil {
-		return nil, err
-	}
-
-	request, err := jsonrpc.UnmarshalRequest(body)
-	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	return request, nil
+	return jsonrpc.UnmarshalRequests(body)
 }
 
 // JSONRPCError returns a JSON-RPC error response
@@ -112,6 +245,11 @@ func (c *SSEContext) JSONRPCResponse(response *jsonrpc.Response) error {
 	return c.JSON(http.StatusOK, response)
 }
 
+// JSONRPCBatchResponse returns a JSON-RPC batch response
+func (c *SSEContext) JSONRPCBatchResponse(responses []*jsonrpc.Response) error {
+	return c.JSON(http.StatusOK, responses)
+}
+
 // JSONRPCAcceptResponse returns a JSON-RPC accept response
 func (c *SSEContext) JSONRPCAcceptResponse(response *jsonrpc.Response) error {
 	return c.JSON(http.StatusAccepted, response)
@@ -139,6 +277,22 @@ func (c *SSEContext) JSONRPCStreamResponse(response *jsonrpc.Response) error {
 	return nil
 }
 
+// JSONRPCStreamBatchResponse returns the responses of a JSON-RPC batch in SSE format, one event per response
+func (c *SSEContext) JSONRPCStreamBatchResponse(responses []*jsonrpc.Response) error {
+	writer, err := NewSSEWriter(c)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "SSE not supported"})
+	}
+
+	for _, response := range responses {
+		if err := writer.SendEventData("jsonrpc", response.String()); err != nil {
+			return err
+		}
+	}
+
+	return writer.SendEventData("stream", "completed")
+}
+
 // JSONRPCStreamStart initiates a streaming response and returns the writer for continued streaming
 func (c *SSEContext) JSONRPCStreamStart() (*SSEWriter, error) {
 	writer, err := NewSSEWriter(c)
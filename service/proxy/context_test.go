@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+)
+
+func TestClientEntryIdle(t *testing.T) {
+	tests := []struct {
+		name         string
+		serverConfig *mcpserver.ServerConfig
+		unused       time.Duration
+		ttl          time.Duration
+		want         bool
+	}{
+		{"used recently", &mcpserver.ServerConfig{}, time.Minute, time.Hour, false},
+		{"unused past the ttl", &mcpserver.ServerConfig{}, time.Hour, time.Minute, true},
+		{"reaper disabled", &mcpserver.ServerConfig{}, time.Hour, 0, false},
+		{"keep warm", &mcpserver.ServerConfig{KeepWarm: true}, time.Hour, time.Minute, false},
+		{"server idle ttl", &mcpserver.ServerConfig{IdleTTL: 60}, 2 * time.Minute, time.Hour, true},
+		{"server idle ttl not reached", &mcpserver.ServerConfig{IdleTTL: 3600}, 2 * time.Minute, time.Minute, false},
+		{"no server config", nil, time.Hour, time.Minute, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := &clientEntry{serverConfig: tt.serverConfig}
+			entry.usedAt.Store(time.Now().Add(-tt.unused).UnixNano())
+
+			if got := entry.idle(tt.ttl); got != tt.want {
+				t.Errorf("idle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+	"github.com/tidwall/gjson"
+)
+
+// Listener receives the messages the session routes to one of its streams
+type Listener struct {
+	messages      chan string
+	progressToken string // raw JSON progress token of the request of a request stream
+	closed        chan struct{}
+	closeOnce     sync.Once
+}
+
+// newListener creates a new listener
+func newListener(progressToken string) *Listener {
+	return &Listener{
+		messages:      make(chan string),
+		progressToken: progressToken,
+		closed:        make(chan struct{}),
+	}
+}
+
+// Messages returns the channel of the messages routed to the stream
+func (l *Listener) Messages() <-chan string {
+	return l.messages
+}
+
+// Closed returns a channel closed when the listener is detached, the GET stream is detached when another one is attached
+func (l *Listener) Closed() <-chan struct{} {
+	return l.closed
+}
+
+// close closes the listener, it is safe to call close more than once
+func (l *Listener) close() {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+}
+
+// ListenStandalone attaches the GET stream of the session, it receives the messages not tied to a request.
+// The GET stream attached before is detached.
+func (s *SSESession) ListenStandalone() *Listener {
+	listener := newListener("")
+
+	s.lmu.Lock()
+	previous := s.standalone
+	s.standalone = listener
+	s.listenersChanged()
+	s.lmu.Unlock()
+
+	if previous != nil {
+		previous.close()
+	}
+
+	return listener
+}
+
+// ListenRequest attaches the stream of a request, it receives the progress notifications of the request.
+// While no GET stream is attached, the only request stream also receives the messages not tied to a request.
+func (s *SSESession) ListenRequest(request *jsonrpc.Request) *Listener {
+	listener := newListener(progressToken(request))
+
+	s.lmu.Lock()
+	s.requestStreams = append(s.requestStreams, listener)
+	s.listenersChanged()
+	s.lmu.Unlock()
+
+	return listener
+}
+
+// Unlisten detaches the stream of the listener, the messages it did not receive are routed to the other streams
+func (s *SSESession) Unlisten(listener *Listener) {
+	s.lmu.Lock()
+	if s.standalone == listener {
+		s.standalone = nil
+	}
+	for i, l := range s.requestStreams {
+		if l == listener {
+			s.requestStreams = append(s.requestStreams[:i], s.requestStreams[i+1:]...)
+			break
+		}
+	}
+	s.listenersChanged()
+	s.lmu.Unlock()
+
+	listener.close()
+}
+
+// listenersChanged wakes up the dispatcher waiting for a stream, the caller holds lmu
+func (s *SSESession) listenersChanged() {
+	close(s.listening)
+	s.listening = make(chan struct{})
+}
+
+// dispatch routes the queued messages of the session to its streams until the session is closed,
+// it is the only reader of the queue and the only goroutine waiting for a slow client
+func (s *SSESession) dispatch() {
+	for {
+		message, ok := s.next()
+		if !ok || !s.deliver(message) {
+			return
+		}
+	}
+}
+
+// deliver hands the message to the stream it is routed to, waiting for one to be attached.
+// It returns false once the session is closed.
+func (s *SSESession) deliver(message string) bool {
+	for {
+		s.lmu.Lock()
+		listener := s.route(message)
+		listening := s.listening
+		s.lmu.Unlock()
+
+		if listener == nil {
+			select {
+			case <-listening:
+				continue
+			case <-s.done:
+				return false
+			}
+		}
+
+		select {
+		case listener.messages <- message:
+			return true
+		case <-listener.closed:
+		case <-listening:
+		case <-s.done:
+			return false
+		}
+	}
+}
+
+// route returns the listener of the stream the message belongs to, nil when none is attached. Progress notifications
+// belong to the stream of their request, other messages to the GET stream, the caller holds lmu.
+func (s *SSESession) route(message string) *Listener {
+	msg := gjson.Parse(message)
+	if msg.Get("method").String() == jsonrpc.MethodProgressNotification {
+		token := msg.Get("params.progressToken").Raw
+		for _, listener := range s.requestStreams {
+			if listener.progressToken != "" && listener.progressToken == token {
+				return listener
+			}
+		}
+	}
+
+	if s.standalone != nil {
+		return s.standalone
+	}
+
+	// With no GET stream, the messages come with the only request in flight
+	if len(s.requestStreams) == 1 {
+		return s.requestStreams[0]
+	}
+
+	return nil
+}
+
+// progressToken returns the raw JSON progress token of the request, empty when it has none
+func progressToken(request *jsonrpc.Request) string {
+	if request.Params == nil {
+		return ""
+	}
+
+	params, err := json.Marshal(request.Params)
+	if err != nil {
+		return ""
+	}
+
+	return gjson.GetBytes(params, "_meta.progressToken").Raw
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+)
+
+func TestSessionDispatch(t *testing.T) {
+	progress := func(token string) string {
+		return `{"jsonrpc":"2.0","method":"notifications/progress","params":{"progressToken":` + token + `}}`
+	}
+	request := func(token interface{}) *jsonrpc.Request {
+		return jsonrpc.NewRequest(jsonrpc.MethodCallTool, map[string]interface{}{
+			"_meta": map[string]interface{}{"progressToken": token},
+		}, 1)
+	}
+	log := `{"jsonrpc":"2.0","method":"notifications/message","params":{}}`
+
+	tests := []struct {
+		name       string
+		standalone bool
+		requests   []*jsonrpc.Request
+		message    string
+		want       int // index of the request stream receiving the message, -1 for the GET stream
+	}{
+		{"progress to its request", true, []*jsonrpc.Request{request("a"), request(2)}, progress(`2`), 1},
+		{"string progress token", true, []*jsonrpc.Request{request("a"), request(2)}, progress(`"a"`), 0},
+		{"unknown progress token", true, []*jsonrpc.Request{request("a")}, progress(`"b"`), -1},
+		{"other message to GET stream", true, []*jsonrpc.Request{request("a")}, log, -1},
+		{"only request stream without GET stream", false, []*jsonrpc.Request{request("a")}, log, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := NewSSESession(nil, nil, &ProxyInfo{SessionID: "s"})
+			defer session.Close()
+
+			var standalone *Listener
+			if tt.standalone {
+				standalone = session.ListenStandalone()
+			}
+			var streams []*Listener
+			for _, r := range tt.requests {
+				streams = append(streams, session.ListenRequest(r))
+			}
+
+			want := standalone
+			if tt.want >= 0 {
+				want = streams[tt.want]
+			}
+
+			session.SendMessage(tt.message)
+
+			select {
+			case message := <-want.Messages():
+				if message != tt.message {
+					t.Errorf("got %s, want %s", message, tt.message)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("message not delivered to the expected stream")
+			}
+		})
+	}
+}
+
+func TestSessionDispatchWaitsForStream(t *testing.T) {
+	session := NewSSESession(nil, nil, &ProxyInfo{SessionID: "s"})
+	defer session.Close()
+
+	// Two request streams and no GET stream: the message waits for the GET stream
+	session.ListenRequest(jsonrpc.NewRequest(jsonrpc.MethodCallTool, nil, 1))
+	session.ListenRequest(jsonrpc.NewRequest(jsonrpc.MethodCallTool, nil, 2))
+	session.SendMessage(`{"jsonrpc":"2.0","method":"notifications/message"}`)
+
+	time.Sleep(50 * time.Millisecond)
+	standalone := session.ListenStandalone()
+
+	select {
+	case <-standalone.Messages():
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered once the GET stream was attached")
+	}
+}
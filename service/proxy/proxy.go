@@ -6,42 +6,38 @@ import (
 	"time"
 
 	"github.com/chatmcp/mcprouter/model"
-	"github.com/chatmcp/mcprouter/util"
 )
 
 // ProxyInfo is the info for the proxy
 type ProxyInfo struct {
-	JSONRPCVersion     string      `json:"jsonrpc_version"`
-	ProtocolVersion    string      `json:"protocol_version"`
-	ConnectionTime     time.Time   `json:"connection_time"`
-	ClientName         string      `json:"client_name"`
-	ClientVersion      string      `json:"client_version"`
-	ClientURL          string      `json:"client_url"`
-	RequestMethod      string      `json:"request_method"`
-	RequestParams      interface{} `json:"request_params"`
-	RequestID          interface{} `json:"request_id"`
-	RequestTime        time.Time   `json:"request_time"`
-	RequestFrom        string      `json:"request_from"`
-	SessionID          string      `json:"session_id"`
-	ServerUUID         string      `json:"server_uuid"`
-	ServerKey          string      `json:"server_key"`
-	ServerConfigName   string      `json:"server_config_name"`
-	ServerShareProcess bool        `json:"server_share_process"`
-	ServerType         string      `json:"server_type"`
-	ServerURL          string      `json:"server_url"`
-	ServerCommand      string      `json:"server_command"`
-	ServerCommandHash  string      `json:"server_command_hash"`
-	ServerName         string      `json:"server_name"`
-	ServerVersion      string      `json:"server_version"`
-	ResponseTime       time.Time   `json:"response_time"`
-	ResponseResult     interface{} `json:"response_result"`
-	ResponseError      string      `json:"response_error"`
-	CostTime           int64       `json:"cost_time"`
-}
-
-// GetSessionID returns the session ID for the proxy info
-func (p *ProxyInfo) GetSessionID() string {
-	return util.MD5(p.ServerKey)
+	JSONRPCVersion        string      `json:"jsonrpc_version"`
+	ProtocolVersion       string      `json:"protocol_version"`
+	ServerProtocolVersion string      `json:"server_protocol_version"`
+	ConnectionTime        time.Time   `json:"connection_time"`
+	ClientName            string      `json:"client_name"`
+	ClientVersion         string      `json:"client_version"`
+	ClientURL             string      `json:"client_url"`
+	RequestMethod         string      `json:"request_method"`
+	RequestParams         interface{} `json:"request_params"`
+	RequestID             interface{} `json:"request_id"`
+	RequestTime           time.Time   `json:"request_time"`
+	RequestFrom           string      `json:"request_from"`
+	HeaderRequestID       string      `json:"header_request_id"` // X-Request-ID header of the http request, RequestID is the JSON-RPC id
+	SessionID             string      `json:"session_id"`
+	ServerUUID            string      `json:"server_uuid"`
+	ServerKey             string      `json:"server_key"`
+	ServerConfigName      string      `json:"server_config_name"`
+	ServerShareProcess    bool        `json:"server_share_process"`
+	ServerType            string      `json:"server_type"`
+	ServerURL             string      `json:"server_url"`
+	ServerCommand         string      `json:"server_command"`
+	ServerCommandHash     string      `json:"server_command_hash"`
+	ServerName            string      `json:"server_name"`
+	ServerVersion         string      `json:"server_version"`
+	ResponseTime          time.Time   `json:"response_time"`
+	ResponseResult        interface{} `json:"response_result"`
+	ResponseError         string      `json:"response_error"`
+	CostTime              int64       `json:"cost_time"`
 }
 
 // ToServerLog converts a ProxyInfo to a ServerLog
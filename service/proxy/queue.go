@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/tidwall/gjson"
+)
+
+// overflow policies of the session message queue, applied when a client falls behind.
+// Responses and server requests are never dropped, the queue grows past its size for them up to its limit.
+const (
+	OverflowBlock      = "block"       // block the sender up to the block timeout for the client to catch up, then drop notifications
+	OverflowDropOldest = "drop_oldest" // drop the oldest queued notification
+	OverflowDisconnect = "disconnect"  // close the session
+)
+
+const (
+	defaultQueueSize    = 100
+	defaultBlockTimeout = 5 // seconds
+
+	// responseHeadroom is how many times its size the queue grows to for responses and server requests,
+	// the session is disconnected past it
+	responseHeadroom = 2
+)
+
+// queueConfig is the message queue config of the sessions
+type queueConfig struct {
+	size         int
+	policy       string
+	blockTimeout time.Duration
+}
+
+// limit returns the number of messages past which a response cannot be queued
+func (c queueConfig) limit() int {
+	return c.size * responseHeadroom
+}
+
+// getQueueConfig returns the message queue config from the proxy_server section
+func getQueueConfig() queueConfig {
+	size := viper.GetInt("proxy_server.queue_size")
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+
+	policy := viper.GetString("proxy_server.overflow_policy")
+	switch policy {
+	case OverflowBlock, OverflowDropOldest, OverflowDisconnect:
+	default:
+		policy = OverflowDropOldest
+	}
+
+	blockTimeout := viper.GetInt("proxy_server.block_timeout")
+	if blockTimeout <= 0 {
+		blockTimeout = defaultBlockTimeout
+	}
+
+	return queueConfig{
+		size:         size,
+		policy:       policy,
+		blockTimeout: time.Duration(blockTimeout) * time.Second,
+	}
+}
+
+// isNotification reports whether the message is a JSON-RPC notification, the only messages that may be dropped
+func isNotification(message string) bool {
+	msg := gjson.Parse(message)
+
+	return msg.IsObject() && msg.Get("method").Exists() && !msg.Get("id").Exists()
+}
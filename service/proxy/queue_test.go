@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSessionOverflow(t *testing.T) {
+	const (
+		n1 = `{"jsonrpc":"2.0","method":"notifications/message","params":{"n":1}}`
+		n2 = `{"jsonrpc":"2.0","method":"notifications/message","params":{"n":2}}`
+		n3 = `{"jsonrpc":"2.0","method":"notifications/message","params":{"n":3}}`
+		r1 = `{"jsonrpc":"2.0","id":1,"result":{}}`
+		r2 = `{"jsonrpc":"2.0","id":2,"result":{}}`
+		q1 = `{"jsonrpc":"2.0","id":"mcprouter-1","method":"sampling/createMessage"}`
+	)
+
+	tests := []struct {
+		name        string
+		policy      string
+		queued      []string
+		message     string
+		want        bool
+		wantQueued  []string
+		wantDropped int64
+		wantClosed  bool
+	}{
+		{"room left", OverflowDropOldest, []string{n1}, n2, true, []string{n1, n2}, 0, false},
+		{"drop oldest notification", OverflowDropOldest, []string{r1, n1, n2}, n3, true, []string{r1, n2, n3}, 1, false},
+		{"drop oldest keeps responses", OverflowDropOldest, []string{r1, q1, n1}, r2, true, []string{r1, q1, r2}, 1, false},
+		{"drop oldest with no notification drops the notification", OverflowDropOldest, []string{r1, q1, r2}, n1, false, []string{r1, q1, r2}, 1, false},
+		{"drop oldest never drops a response", OverflowDropOldest, []string{r1, q1, r2}, q1, true, []string{r1, q1, r2, q1}, 0, false},
+		{"response past the limit disconnects", OverflowDropOldest, []string{r1, q1, r2, r1, q1, r2}, r1, false, []string{r1, q1, r2, r1, q1, r2}, 1, true},
+		{"block drops notifications after the timeout", OverflowBlock, []string{n1, n2, n3}, n1, false, []string{n1, n2, n3}, 1, false},
+		{"block keeps responses after the timeout", OverflowBlock, []string{n1, n2, n3}, r1, true, []string{n1, n2, n3, r1}, 0, false},
+		{"disconnect", OverflowDisconnect, []string{n1, n2, n3}, r1, false, []string{n1, n2, n3}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// no dispatcher runs, the block policy always times out
+			session := newSession(nil, nil, &ProxyInfo{SessionID: "s"}, queueConfig{
+				size:         3,
+				policy:       tt.policy,
+				blockTimeout: 50 * time.Millisecond,
+			})
+			session.queued = append([]string(nil), tt.queued...)
+
+			if got := session.SendMessage(tt.message); got != tt.want {
+				t.Errorf("SendMessage() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(session.queued, tt.wantQueued) {
+				t.Errorf("queued = %v, want %v", session.queued, tt.wantQueued)
+			}
+			if got := session.Dropped(); got != tt.wantDropped {
+				t.Errorf("Dropped() = %d, want %d", got, tt.wantDropped)
+			}
+
+			select {
+			case <-session.Done():
+				if !tt.wantClosed {
+					t.Error("session closed")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.wantClosed {
+					t.Error("session not closed")
+				}
+			}
+		})
+	}
+}
+
+func TestSessionBlockWaitsForRoom(t *testing.T) {
+	session := newSession(nil, nil, &ProxyInfo{SessionID: "s"}, queueConfig{size: 1, policy: OverflowBlock, blockTimeout: time.Minute})
+	defer session.Close()
+
+	session.SendMessage(`{"jsonrpc":"2.0","method":"notifications/message","params":{"n":1}}`)
+
+	queued := make(chan bool, 1)
+	go func() {
+		queued <- session.SendMessage(`{"jsonrpc":"2.0","method":"notifications/message","params":{"n":2}}`)
+	}()
+
+	select {
+	case <-queued:
+		t.Fatal("SendMessage() on a full queue did not block")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, ok := session.next(); !ok {
+		t.Fatal("next() found no message")
+	}
+
+	select {
+	case ok := <-queued:
+		if !ok {
+			t.Error("SendMessage() = false once the queue had room")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SendMessage() still blocked once the queue had room")
+	}
+	if session.Dropped() != 0 {
+		t.Errorf("Dropped() = %d, want 0", session.Dropped())
+	}
+}
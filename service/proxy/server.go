@@ -1,35 +1,218 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/chatmcp/mcprouter/service/mcpclient"
+	"github.com/chatmcp/mcprouter/util"
 	"github.com/labstack/echo/v4"
 )
 
+// idleCheckInterval is how often sessions are checked for idleness
+const idleCheckInterval = 30 * time.Second
+
+// drainCheckInterval is how often sessions are checked for in-flight requests on shutdown
+const drainCheckInterval = 100 * time.Millisecond
+
 // SSEServer as the proxy server for SSE request
 type SSEServer struct {
-	server   *echo.Echo // http server built with echo
-	sessions *sync.Map  // sessions store
-	clients  *sync.Map  // clients store
+	server   *echo.Echo      // http server built with echo
+	sessions *sync.Map       // sessions store
+	clients  *sync.Map       // clients store
+	draining *atomic.Bool    // set once the server is shutting down
+	shutdown context.Context // done once the server is shutting down, the background loops stop with it
+	cancel   context.CancelFunc
 }
 
 // NewSSEServer will create SSE server
 func NewSSEServer() *SSEServer {
+	shutdown, cancel := context.WithCancel(context.Background())
+
 	return &SSEServer{
 		server:   echo.New(),
 		sessions: &sync.Map{},
 		clients:  &sync.Map{},
+		draining: &atomic.Bool{},
+		shutdown: shutdown,
+		cancel:   cancel,
 	}
 }
 
 // Route will create the routes for http server
 func (s *SSEServer) Route(route func(e *echo.Echo)) {
-	s.server.Use(createSSEMiddleware(s.sessions, s.clients))
+	s.server.Use(createSSEMiddleware(s.sessions, s.clients, s.draining))
 	route(s.server)
 }
 
-// Start will start the http server
-func (s *SSEServer) Start(port int) {
-	s.server.Logger.Fatal(s.server.Start(fmt.Sprintf(":%d", port)))
+// context returns a context over the stores of the server, for use outside of a request
+func (s *SSEServer) context() *SSEContext {
+	return &SSEContext{
+		sessions: s.sessions,
+		clients:  s.clients,
+		draining: s.draining,
+	}
+}
+
+// CloseIdleSessions will close the sessions whose client has been idle for the timeout, in the background
+// until the server shuts down
+func (s *SSEServer) CloseIdleSessions(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+
+	interval := min(timeout, idleCheckInterval)
+	ctx := s.context()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.shutdown.Done():
+				return
+			case <-ticker.C:
+			}
+
+			s.sessions.Range(func(key, value any) bool {
+				if session := value.(*SSESession); session.Idle(timeout) {
+					fmt.Printf("closing idle session %s\n", key)
+					ctx.CloseSession(key.(string))
+				}
+				return true
+			})
+		}
+	}()
+}
+
+// CloseIdleClients will close, in the background, the shared clients not used for the ttl of their server,
+// ttl applies to the servers with no idle_ttl, until the server shuts down. Clients with live sessions are left alone.
+func (s *SSEServer) CloseIdleClients(ttl time.Duration) {
+	ctx := s.context()
+
+	go func() {
+		ticker := time.NewTicker(idleCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.shutdown.Done():
+				return
+			case <-ticker.C:
+			}
+
+			s.clients.Range(func(key, value any) bool {
+				entry := value.(*clientEntry)
+				if !entry.idle(ttl) || ctx.HasSessions(key.(string)) {
+					return true
+				}
+
+				fmt.Printf("closing idle client of %s\n", key)
+				s.closeClient(key.(string), entry)
+				return true
+			})
+		}
+	}()
+}
+
+// closeClient closes the client of the server key, and logs the usage of its processes
+func (s *SSEServer) closeClient(key string, entry *clientEntry) {
+	// a failed request may have replaced the client already
+	if !s.clients.CompareAndDelete(key, entry) {
+		return
+	}
+	entry.client.Close()
+
+	for _, usage := range mcpclient.Usage(entry.client) {
+		fmt.Printf("closed idle process of %s: %s\n", key, usage)
+	}
+}
+
+// Start will start the http server, it shuts down gracefully on SIGINT or SIGTERM
+func (s *SSEServer) Start(port int, shutdownTimeout time.Duration) {
+	go func() {
+		if err := s.server.Start(fmt.Sprintf(":%d", port)); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.server.Logger.Fatal(err)
+		}
+	}()
+
+	sig := util.WaitForShutdownSignal()
+	fmt.Printf("received %s, shutting down\n", sig)
+
+	s.Shutdown(shutdownTimeout)
+}
+
+// Shutdown will stop accepting new sessions, wait for the in-flight requests up to the timeout,
+// close the open sessions and release every backend
+func (s *SSEServer) Shutdown(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	s.draining.Store(true)
+
+	// the reapers stop, the sessions and clients are closed below
+	s.cancel()
+
+	// stop listening, the open connections are served until they are done
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- s.server.Shutdown(ctx)
+	}()
+
+	s.waitRequests(ctx)
+
+	// closed sessions send the closing event on their streams
+	sctx := s.context()
+	s.sessions.Range(func(key, _ any) bool {
+		sctx.CloseSession(key.(string))
+		return true
+	})
+
+	if err := <-stopped; err != nil {
+		fmt.Printf("failed to shutdown server: %v\n", err)
+		s.server.Close()
+	}
+
+	s.clients.Range(func(key, value any) bool {
+		if err := value.(*clientEntry).client.Close(); err != nil {
+			fmt.Printf("failed to close client %s: %v\n", key, err)
+		}
+		s.clients.Delete(key)
+		return true
+	})
+
+	mcpclient.KillProcesses()
+
+	fmt.Println("server shutdown")
+}
+
+// waitRequests waits until no session has requests in flight, or ctx is done
+func (s *SSEServer) waitRequests(ctx context.Context) {
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		busy := false
+		s.sessions.Range(func(_, value any) bool {
+			busy = value.(*SSESession).Busy()
+			return !busy
+		})
+
+		if !busy {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Println("timeout waiting for in-flight requests")
+			return
+		case <-ticker.C:
+		}
+	}
 }
@@ -1,32 +1,91 @@
 package proxy
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
 	"github.com/chatmcp/mcprouter/service/mcpclient"
 	"github.com/chatmcp/mcprouter/service/mcpserver"
+	"github.com/tidwall/sjson"
 )
 
+// ErrDuplicateRequestID is returned for a client request whose id is already in flight in the session
+var ErrDuplicateRequestID = errors.New("request id is already in flight")
+
+// serverRequestTimeout is how long a server-initiated request waits for the client response
+const serverRequestTimeout = 60 * time.Second
+
 // SSESession is a session for SSE request
 type SSESession struct {
-	writer       *SSEWriter
-	done         chan struct{} // done channel
-	messages     chan string   // event queue
-	serverConfig *mcpserver.ServerConfig
-	proxyInfo    *ProxyInfo
-	client       mcpclient.Client
+	writer         *SSEWriter
+	done           chan struct{} // done channel
+	closeOnce      sync.Once
+	ctx            context.Context // cancelled when the session is closed
+	cancel         context.CancelFunc
+	queued         []string      // messages waiting for the dispatcher
+	wake           chan struct{} // wakes the dispatcher up when a message is queued
+	room           chan struct{} // closed when the full queue has room again, nil while nobody waits for it
+	queue          queueConfig
+	qmu            sync.Mutex
+	dropped        atomic.Int64 // messages not delivered because the queue was full
+	serverConfig   *mcpserver.ServerConfig
+	proxyInfo      *ProxyInfo
+	client         mcpclient.Client // dedicated client, set when the server does not share its process
+	mu             sync.RWMutex
+	pending        map[string]chan []byte // server requests waiting for the client response
+	pmu            sync.Mutex
+	nextID         atomic.Int64                  // server request id sequence
+	inflight       atomic.Int64                  // client requests being forwarded
+	activeAt       atomic.Int64                  // last client request time
+	open           atomic.Int64                  // client requests not released yet
+	calls          map[string]context.CancelFunc // client requests being forwarded, by request id
+	cmu            sync.Mutex
+	events         *eventBuffer  // events of the resumable streams
+	subscribed     sync.Map      // uris of the resources the client subscribed to
+	nextStream     atomic.Int64  // request stream id sequence
+	standalone     *Listener     // GET stream
+	requestStreams []*Listener   // request streams, in the order they were opened
+	listening      chan struct{} // closed when the streams change
+	lmu            sync.Mutex
 }
 
 // NewSSESession will create a new SSE session
 func NewSSESession(w *SSEWriter, serverConfig *mcpserver.ServerConfig, proxyInfo *ProxyInfo) *SSESession {
-	return &SSESession{
+	session := newSession(w, serverConfig, proxyInfo, getQueueConfig())
+	go session.dispatch()
+
+	return session
+}
+
+// newSession creates a session with the message queue config, its dispatcher is not started
+func newSession(w *SSEWriter, serverConfig *mcpserver.ServerConfig, proxyInfo *ProxyInfo, queue queueConfig) *SSESession {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	session := &SSESession{
 		writer:       w,
 		done:         make(chan struct{}),
-		messages:     make(chan string, 100), // store messages
+		ctx:          ctx,
+		cancel:       cancel,
+		wake:         make(chan struct{}, 1),
+		queue:        queue,
 		serverConfig: serverConfig,
 		proxyInfo:    proxyInfo,
 		client:       nil,
+		pending:      make(map[string]chan []byte),
+		calls:        make(map[string]context.CancelFunc),
+		events:       newEventBuffer(),
+		listening:    make(chan struct{}),
 	}
+	session.activeAt.Store(time.Now().UnixNano())
+
+	return session
 }
 
 // ServerConfig returns the server config of the session
@@ -39,11 +98,26 @@ func (s *SSESession) ProxyInfo() *ProxyInfo {
 	return s.proxyInfo
 }
 
+// ID returns the ID of the session
+func (s *SSESession) ID() string {
+	return s.proxyInfo.SessionID
+}
+
 // Key returns the key of the session
 func (s *SSESession) Key() string {
 	return s.proxyInfo.ServerKey
 }
 
+// Uses reports whether the session uses the backend of the server key, the one of its own key
+// or the one of a member of its composite server
+func (s *SSESession) Uses(key string) bool {
+	if s.Key() == key {
+		return true
+	}
+
+	return s.serverConfig != nil && s.serverConfig.Composite() && slices.Contains(s.serverConfig.Members, key)
+}
+
 // Command returns the command of the session
 func (s *SSESession) Command() string {
 	return s.proxyInfo.ServerCommand
@@ -56,40 +130,368 @@ func (s *SSESession) SetProxyInfo(proxyInfo *ProxyInfo) {
 
 // SetClient sets the client of the session
 func (s *SSESession) SetClient(client mcpclient.Client) {
+	s.mu.Lock()
 	s.client = client
+	s.mu.Unlock()
 }
 
 // Client returns the client of the session
 func (s *SSESession) Client() mcpclient.Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	return s.client
 }
 
-// Messages returns the messages channel of the session
-func (s *SSESession) Messages() chan string {
-	return s.messages
+// ShareProcess reports whether the session uses the shared backend process of its server key
+func (s *SSESession) ShareProcess() bool {
+	return s.serverConfig == nil || s.serverConfig.ShareProcess
+}
+
+// SendMessage queues a message for the client of the session, the dispatcher of the session delivers it.
+// When the queue is full the overflow policy applies, the block policy holds the caller up to the block timeout.
+// Responses and server requests are never dropped, the queue grows up to its limit for them and the session
+// is disconnected past it. It reports whether the message was queued.
+func (s *SSESession) SendMessage(message string) bool {
+	s.qmu.Lock()
+	defer s.qmu.Unlock()
+
+	if s.closed() {
+		fmt.Printf("session is closed\n")
+		return false
+	}
+
+	if len(s.queued) >= s.queue.size && s.queue.policy == OverflowBlock {
+		s.waitRoom()
+		if s.closed() {
+			return false
+		}
+	}
+
+	if len(s.queued) >= s.queue.size && !s.overflow(message) {
+		return false
+	}
+
+	s.queued = append(s.queued, message)
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return true
 }
 
-// SendMessage sends a message to the session
-func (s *SSESession) SendMessage(message string) {
+// closed reports whether the session is closed
+func (s *SSESession) closed() bool {
 	select {
-	case s.messages <- message:
-		// send message to client ok
 	case <-s.done:
-		fmt.Printf("session is closed\n")
+		return true
 	default:
-		fmt.Printf("message channel is full\n")
+		return false
+	}
+}
+
+// waitRoom waits up to the block timeout for the dispatcher to make room in the full queue,
+// or for the session to close. The caller holds qmu, it is released while waiting.
+func (s *SSESession) waitRoom() {
+	timer := time.NewTimer(s.queue.blockTimeout)
+	defer timer.Stop()
+
+	for len(s.queued) >= s.queue.size {
+		if s.room == nil {
+			s.room = make(chan struct{})
+		}
+		room := s.room
+
+		s.qmu.Unlock()
+		waiting := true
+		select {
+		case <-room:
+		case <-s.done:
+			waiting = false
+		case <-timer.C:
+			waiting = false
+		}
+		s.qmu.Lock()
+
+		if !waiting {
+			return
+		}
 	}
 }
 
-// Close closes the session
+// overflow applies the overflow policy to the message arriving at a full queue, it reports whether
+// the message is to be queued. The caller holds qmu.
+func (s *SSESession) overflow(message string) bool {
+	switch s.queue.policy {
+	case OverflowDisconnect:
+		s.disconnect("disconnecting")
+		return false
+	case OverflowDropOldest:
+		for i, m := range s.queued {
+			if isNotification(m) {
+				s.queued = append(s.queued[:i], s.queued[i+1:]...)
+				s.drop("oldest notification dropped")
+				return true
+			}
+		}
+	}
+
+	// Responses and server requests are never dropped, a client too far behind for them is disconnected
+	if !isNotification(message) {
+		if len(s.queued) < s.queue.limit() {
+			return true
+		}
+		s.disconnect("response cannot be queued, disconnecting")
+		return false
+	}
+
+	s.drop("notification dropped")
+	return false
+}
+
+// disconnect counts the message not delivered and closes the session. The caller holds qmu.
+func (s *SSESession) disconnect(action string) {
+	s.drop(action)
+	// Closing waits for the dedicated client, it is not done holding qmu
+	go s.Close()
+}
+
+// next waits for the next queued message, it returns false once the session is closed
+func (s *SSESession) next() (string, bool) {
+	for {
+		s.qmu.Lock()
+		if len(s.queued) > 0 {
+			message := s.queued[0]
+			s.queued = s.queued[1:]
+			if s.room != nil && len(s.queued) < s.queue.size {
+				close(s.room)
+				s.room = nil
+			}
+			s.qmu.Unlock()
+			return message, true
+		}
+		s.qmu.Unlock()
+
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return "", false
+		}
+	}
+}
+
+// drop counts and logs a message not delivered because the queue of the session was full
+func (s *SSESession) drop(action string) {
+	dropped := s.dropped.Add(1)
+	fmt.Printf("message queue of session %s is full, %s (%d dropped)\n", s.ID(), action, dropped)
+}
+
+// Dropped returns the number of messages not delivered to the session because its queue was full
+func (s *SSESession) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// BeginRequest marks a client request of the session as being forwarded
+func (s *SSESession) BeginRequest() {
+	s.inflight.Add(1)
+	s.activeAt.Store(time.Now().UnixNano())
+}
+
+// EndRequest marks a forwarded client request of the session as done
+func (s *SSESession) EndRequest() {
+	s.inflight.Add(-1)
+}
+
+// Busy reports whether the session has client requests in flight
+func (s *SSESession) Busy() bool {
+	return s.open.Load() > 0 || s.inflight.Load() > 0
+}
+
+// Idle reports whether the client of the session has neither sent a request nor a response for the timeout,
+// and has no request in flight
+func (s *SSESession) Idle(timeout time.Duration) bool {
+	if s.Busy() {
+		return false
+	}
+
+	return time.Since(time.Unix(0, s.activeAt.Load())) > timeout
+}
+
+// Subscribe records the subscription of the client to the resource, updates of the resource are sent to subscribers only
+func (s *SSESession) Subscribe(uri string) {
+	s.subscribed.Store(uri, true)
+}
+
+// Unsubscribe removes the subscription of the client to the resource
+func (s *SSESession) Unsubscribe(uri string) {
+	s.subscribed.Delete(uri)
+}
+
+// Subscribed reports whether the client subscribed to the resource
+func (s *SSESession) Subscribed(uri string) bool {
+	_, ok := s.subscribed.Load(uri)
+	return ok
+}
+
+// Context returns the context of the session, it is done when the session is closed
+func (s *SSESession) Context() context.Context {
+	return s.ctx
+}
+
+// RequestContext returns the context of a client request, it is done when parent is done, when the session
+// is closed or when the client cancels the request. release must be called once the request is done.
+// A request whose id is already in flight in the session is rejected with ErrDuplicateRequestID.
+func (s *SSESession) RequestContext(parent context.Context, id interface{}) (ctx context.Context, release func(), err error) {
+	key, err := requestKey(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the backend messages about the request are routed back to the session
+	ctx, cancel := context.WithCancel(mcpclient.WithSession(parent, s.ID()))
+
+	if id != nil {
+		s.cmu.Lock()
+		if _, ok := s.calls[key]; ok {
+			s.cmu.Unlock()
+			cancel()
+			return nil, nil, ErrDuplicateRequestID
+		}
+		s.calls[key] = cancel
+		s.cmu.Unlock()
+	}
+
+	stop := context.AfterFunc(s.ctx, cancel)
+
+	s.open.Add(1)
+	s.activeAt.Store(time.Now().UnixNano())
+
+	return ctx, func() {
+		stop()
+		s.open.Add(-1)
+		if id != nil {
+			s.cmu.Lock()
+			delete(s.calls, key)
+			s.cmu.Unlock()
+		}
+		cancel()
+	}, nil
+}
+
+// Cancel cancels the client request with the given id, it reports whether the request was in flight
+func (s *SSESession) Cancel(id interface{}) bool {
+	key, err := requestKey(id)
+	if err != nil {
+		fmt.Printf("invalid request id to cancel: %v\n", err)
+		return false
+	}
+
+	s.cmu.Lock()
+	cancel, ok := s.calls[key]
+	s.cmu.Unlock()
+
+	if !ok {
+		fmt.Printf("no request in flight to cancel: %s\n", key)
+		return false
+	}
+
+	cancel()
+
+	return true
+}
+
+// requestKey returns the raw JSON of a request id, so that the string id "1" and the number id 1 differ
+func requestKey(id interface{}) (string, error) {
+	raw, err := json.Marshal(id)
+	if err != nil {
+		return "", fmt.Errorf("invalid request id %v: %w", id, err)
+	}
+
+	return string(raw), nil
+}
+
+// Request sends a server-initiated request to the client and waits for its response.
+// The request ID is replaced with one unique to the session, the response keeps it.
+func (s *SSESession) Request(message []byte) ([]byte, error) {
+	id := fmt.Sprintf("mcprouter-%d", s.nextID.Add(1))
+
+	message, err := sjson.SetBytes(message, "id", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set server request id: %w", err)
+	}
+
+	msgch := make(chan []byte, 1)
+
+	s.pmu.Lock()
+	s.pending[id] = msgch
+	s.pmu.Unlock()
+
+	defer func() {
+		s.pmu.Lock()
+		delete(s.pending, id)
+		s.pmu.Unlock()
+	}()
+
+	if !s.SendMessage(string(message)) {
+		return nil, errors.New("failed to queue server request")
+	}
+
+	select {
+	case response := <-msgch:
+		return response, nil
+	case <-s.done:
+		return nil, errors.New("session closed with no response")
+	case <-time.After(serverRequestTimeout):
+		return nil, errors.New("timeout waiting for client response")
+	}
+}
+
+// Respond delivers the client response to the pending server request, it reports whether one was waiting
+func (s *SSESession) Respond(response *jsonrpc.Response) bool {
+	id := fmt.Sprintf("%v", response.ID)
+
+	s.pmu.Lock()
+	msgch, ok := s.pending[id]
+	s.pmu.Unlock()
+
+	if !ok {
+		fmt.Printf("no pending server request for response: %s\n", id)
+		return false
+	}
+
+	s.activeAt.Store(time.Now().UnixNano())
+
+	select {
+	case msgch <- []byte(response.String()):
+		return true
+	default:
+		return false
+	}
+}
+
+// Close closes the session, it is safe to call Close more than once
 func (s *SSESession) Close() {
-	s.CloseClient()
-	close(s.done)
+	s.closeOnce.Do(func() {
+		if dropped := s.dropped.Load(); dropped > 0 {
+			fmt.Printf("session %s closed with %d messages dropped\n", s.ID(), dropped)
+		}
+		s.cancel()
+		s.CloseClient()
+		close(s.done)
+	})
 }
 
+// CloseClient closes and releases the dedicated client of the session
 func (s *SSESession) CloseClient() {
-	if s.client != nil {
-		s.client.Close()
+	s.mu.Lock()
+	client := s.client
+	s.client = nil
+	s.mu.Unlock()
+
+	if client != nil {
+		client.Close()
 		fmt.Printf("client closed\n")
 	}
 }
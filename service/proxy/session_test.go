@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/chatmcp/mcprouter/service/mcpserver"
+)
+
+func TestSessionUses(t *testing.T) {
+	composite := &mcpserver.ServerConfig{ServerType: mcpserver.ServerTypeComposite, Members: []string{"a", "b"}}
+
+	tests := []struct {
+		name         string
+		serverConfig *mcpserver.ServerConfig
+		key          string
+		want         bool
+	}{
+		{"own key", &mcpserver.ServerConfig{}, "s", true},
+		{"other key", &mcpserver.ServerConfig{}, "a", false},
+		{"composite key", composite, "s", true},
+		{"composite member", composite, "b", true},
+		{"not a member", composite, "c", false},
+		{"no server config", nil, "a", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newSession(nil, tt.serverConfig, &ProxyInfo{ServerKey: "s"}, queueConfig{size: 1})
+			if got := session.Uses(tt.key); got != tt.want {
+				t.Errorf("Uses(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionRequestContext(t *testing.T) {
+	tests := []struct {
+		name      string
+		inFlight  interface{}
+		id        interface{}
+		wantErr   error
+		cancel    interface{}
+		wantFound bool
+	}{
+		{"string and number ids differ", float64(1), "1", nil, "1", true},
+		{"number and string ids differ", "1", float64(1), nil, float64(1), true},
+		{"duplicate number id", float64(1), float64(1), ErrDuplicateRequestID, float64(1), true},
+		{"duplicate string id", "a", "a", ErrDuplicateRequestID, "a", true},
+		{"cancel unknown id", float64(1), float64(2), nil, float64(3), false},
+		{"notifications have no id", nil, nil, nil, float64(1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newSession(nil, nil, &ProxyInfo{SessionID: "s"}, queueConfig{size: 1})
+			defer session.Close()
+
+			_, release, err := session.RequestContext(context.Background(), tt.inFlight)
+			if err != nil {
+				t.Fatalf("RequestContext() error = %v", err)
+			}
+			defer release()
+
+			ctx, release, err := session.RequestContext(context.Background(), tt.id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RequestContext() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer release()
+
+			if got := session.Cancel(tt.cancel); got != tt.wantFound {
+				t.Errorf("Cancel(%v) = %v, want %v", tt.cancel, got, tt.wantFound)
+			}
+			if canceled := ctx.Err() != nil; canceled != tt.wantFound {
+				t.Errorf("request canceled = %v, want %v", canceled, tt.wantFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/chatmcp/mcprouter/service/jsonrpc"
+)
+
+// eventBufferSize is the number of events a session keeps for replay
+const eventBufferSize = 100
+
+// standaloneStreamID is the stream id of the GET stream of a session
+const standaloneStreamID = "g"
+
+// ErrEventNotFound is returned when the event to resume after is no longer in the replay buffer
+var ErrEventNotFound = errors.New("event not found")
+
+// ErrEventsLost is returned when events that followed the event to resume after are no longer in the replay buffer
+var ErrEventsLost = errors.New("events after the event are no longer buffered")
+
+// bufferedEvent is an event kept for replay
+type bufferedEvent struct {
+	id     string
+	stream string
+	seq    int64
+	event  string
+	data   string
+	final  bool // last event of a request stream
+}
+
+// eventBuffer is a bounded buffer of the events sent on the streams of a session
+type eventBuffer struct {
+	mu     sync.Mutex
+	events []*bufferedEvent
+	seq    int64
+	added  chan struct{} // closed when an event is added
+}
+
+// newEventBuffer creates a new event buffer
+func newEventBuffer() *eventBuffer {
+	return &eventBuffer{
+		added: make(chan struct{}),
+	}
+}
+
+// add records an event of the stream and returns its id
+func (b *eventBuffer) add(stream string, event string, data string, final bool) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	e := &bufferedEvent{
+		id:     fmt.Sprintf("%s-%d", stream, b.seq),
+		stream: stream,
+		seq:    b.seq,
+		event:  event,
+		data:   data,
+		final:  final,
+	}
+
+	b.events = append(b.events, e)
+	if len(b.events) > eventBufferSize {
+		b.events = b.events[len(b.events)-eventBufferSize:]
+	}
+
+	close(b.added)
+	b.added = make(chan struct{})
+
+	return e.id
+}
+
+// find returns the buffered event with the given id
+func (b *eventBuffer) find(id string) *bufferedEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, e := range b.events {
+		if e.id == id {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// lost reports whether events that followed seq were dropped from the buffer
+func (b *eventBuffer) lost(seq int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.events) > 0 && b.events[0].seq > seq+1
+}
+
+// after returns the buffered events of the stream that follow seq,
+// and a channel closed when the next event is added
+func (b *eventBuffer) after(stream string, seq int64) ([]*bufferedEvent, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var events []*bufferedEvent
+	for _, e := range b.events {
+		if e.stream == stream && e.seq > seq {
+			events = append(events, e)
+		}
+	}
+
+	return events, b.added
+}
+
+// parseEventID returns the stream and the sequence number of an event id
+func parseEventID(id string) (string, int64, bool) {
+	i := strings.LastIndex(id, "-")
+	if i <= 0 {
+		return "", 0, false
+	}
+
+	seq, err := strconv.ParseInt(id[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return id[:i], seq, true
+}
+
+// EventStream is a resumable stream of a session: its events carry ids and are kept in the replay buffer
+// of the session, so that a client reconnecting with Last-Event-ID receives the events it missed.
+type EventStream struct {
+	id      string
+	session *SSESession
+	writer  *SSEWriter
+	broken  bool // the connection is gone, events are only buffered
+}
+
+// OpenStream opens a new request stream of the session on the writer
+func (s *SSESession) OpenStream(writer *SSEWriter) *EventStream {
+	return &EventStream{
+		id:      fmt.Sprintf("r%d", s.nextStream.Add(1)),
+		session: s,
+		writer:  writer,
+	}
+}
+
+// StandaloneStream opens the GET stream of the session on the writer
+func (s *SSESession) StandaloneStream(writer *SSEWriter) *EventStream {
+	return &EventStream{
+		id:      standaloneStreamID,
+		session: s,
+		writer:  writer,
+	}
+}
+
+// send buffers the event and writes it unless the connection is gone, it returns the error of the write
+// that finds the connection gone, the events that follow are only buffered
+func (e *EventStream) send(event string, data string, final bool) error {
+	id := e.session.events.add(e.id, event, data, final)
+	if e.broken {
+		return nil
+	}
+
+	if err := e.writer.SendEvent(id, event, data); err != nil {
+		e.broken = true
+		return err
+	}
+
+	return nil
+}
+
+// Start sends the event that starts a request stream, its id lets the client resume the stream
+// even when the connection is lost before any message
+func (e *EventStream) Start() error {
+	return e.send("stream", "started", false)
+}
+
+// SendMessage sends a message event on the stream
+func (e *EventStream) SendMessage(message string) error {
+	return e.send("message", message, false)
+}
+
+// Complete sends the response and the completion event that end a request stream,
+// they are buffered for a resuming client even when the connection is gone
+func (e *EventStream) Complete(response *jsonrpc.Response) error {
+	var err error
+	if response != nil {
+		err = e.send("jsonrpc", response.String(), false)
+	}
+
+	if cerr := e.send("stream", "completed", true); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// ResumeStream replays on the writer the events that followed lastEventID on its stream. A request stream is followed
+// until it completes, standalone reports whether the resumed stream is the GET stream, which the caller continues.
+func (s *SSESession) ResumeStream(ctx context.Context, writer *SSEWriter, lastEventID string) (standalone bool, err error) {
+	stream, seq, ok := parseEventID(lastEventID)
+	if !ok {
+		return false, ErrEventNotFound
+	}
+
+	standalone = stream == standaloneStreamID
+
+	// Request streams can only be resumed from a buffered event, as the events that followed may be lost
+	if !standalone {
+		last := s.events.find(lastEventID)
+		if last == nil {
+			return false, ErrEventNotFound
+		}
+		if last.final {
+			return false, nil
+		}
+	}
+
+	// The GET stream is resumed from any event, a client behind the buffer would silently miss events.
+	// The buffer is shared by the streams, the events dropped may have been of other streams.
+	if s.events.lost(seq) {
+		return false, ErrEventsLost
+	}
+
+	for {
+		events, added := s.events.after(stream, seq)
+		for _, e := range events {
+			if err := writer.SendEvent(e.id, e.event, e.data); err != nil {
+				return standalone, err
+			}
+
+			seq = e.seq
+			if e.final {
+				return false, nil
+			}
+		}
+
+		if standalone {
+			return true, nil
+		}
+
+		select {
+		case <-added:
+		case <-s.done:
+			return false, nil
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestResumeStandaloneStream(t *testing.T) {
+	tests := []struct {
+		name        string
+		events      int
+		lastEventID string
+		wantErr     error
+		wantFirst   string // id of the first event replayed
+	}{
+		{"events buffered", 3, "g-1", nil, "g-2"},
+		{"oldest event follows", eventBufferSize + 10, "g-10", nil, "g-11"},
+		{"events dropped", eventBufferSize + 10, "g-2", ErrEventsLost, ""},
+		{"unknown event id", 3, "nope", ErrEventNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newSession(nil, nil, &ProxyInfo{SessionID: "s"}, getQueueConfig())
+			defer session.Close()
+
+			for i := 0; i < tt.events; i++ {
+				session.events.add(standaloneStreamID, "message", strconv.Itoa(i), false)
+			}
+
+			rec := httptest.NewRecorder()
+			writer, err := NewSSEWriter(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			standalone, err := session.ResumeStream(context.Background(), writer, tt.lastEventID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ResumeStream() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if rec.Body.Len() > 0 {
+					t.Errorf("rejected resume replayed events: %s", rec.Body)
+				}
+				return
+			}
+
+			if !standalone {
+				t.Error("ResumeStream() standalone = false, want true")
+			}
+			if first := strings.SplitN(rec.Body.String(), "\n", 2)[0]; first != "id: "+tt.wantFirst {
+				t.Errorf("first replayed line = %q, want id %s", first, tt.wantFirst)
+			}
+		})
+	}
+}
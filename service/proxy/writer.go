@@ -44,6 +44,17 @@ func (s *SSEWriter) SendEventData(event string, data string) error {
 	return nil
 }
 
+// SendEvent will send the event data with its id to the client
+func (s *SSEWriter) SendEvent(id string, event string, data string) error {
+	if _, err := fmt.Fprintf(s.w, "id: %s\nevent: %s\ndata: %s\n\n", id, event, data); err != nil {
+		return err
+	}
+
+	s.f.Flush()
+
+	return nil
+}
+
 // SendData will send the data to the client
 func (s *SSEWriter) SendData(data string) error {
 	if _, err := fmt.Fprintf(s.w, "data: %s\n\n", data); err != nil {
@@ -60,7 +71,13 @@ func (s *SSEWriter) SendMessage(message string) error {
 	return s.SendEventData("message", message)
 }
 
-// SendHeartbeat will send the message to the client
+// SendHeartbeat will send a comment to the client, it keeps the connection open and is ignored by clients
 func (s *SSEWriter) SendHeartbeat() error {
-	return s.SendEventData("heartbeat", ":\n")
+	if _, err := fmt.Fprint(s.w, ": ping\n\n"); err != nil {
+		return err
+	}
+
+	s.f.Flush()
+
+	return nil
 }
@@ -1,12 +1,21 @@
 package util
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/pelletier/go-toml/v2"
 	"github.com/spf13/viper"
 )
 
+// rawConfig is the config file with the case of its keys, viper lowercases them
+var rawConfig atomic.Value // map[string]interface{}
+
 // InitConfigWithFile will read config from file
 func InitConfigWithFile(filename string) error {
 	viper.SetConfigFile(filename)
@@ -14,11 +23,67 @@ func InitConfigWithFile(filename string) error {
 	if err := viper.ReadInConfig(); err != nil {
 		return err
 	}
+	loadRawConfig(filename)
 
 	viper.WatchConfig()
 	viper.OnConfigChange(func(e fsnotify.Event) {
 		fmt.Printf("Config file changed: %s\n", e.Name)
+		loadRawConfig(filename)
 	})
 
 	return nil
 }
+
+// loadRawConfig reads the toml or json config file with the case of its keys
+func loadRawConfig(filename string) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Printf("failed to read raw config: %v\n", err)
+		return
+	}
+
+	config := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".toml":
+		err = toml.Unmarshal(data, &config)
+	case ".json":
+		err = json.Unmarshal(data, &config)
+	default:
+		return
+	}
+	if err != nil {
+		fmt.Printf("failed to parse raw config: %v\n", err)
+		return
+	}
+
+	rawConfig.Store(config)
+}
+
+// GetRawStringMapString returns the string map at the dotted path of the config file with the case of its keys,
+// nil when there is none. The keys of the path match case-insensitively, as they do with viper.
+func GetRawStringMapString(path string) map[string]string {
+	value, _ := rawConfig.Load().(map[string]interface{})
+
+	for _, key := range strings.Split(path, ".") {
+		var found interface{}
+		for name, v := range value {
+			if strings.EqualFold(name, key) {
+				found = v
+				break
+			}
+		}
+
+		m, ok := found.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m
+	}
+
+	result := make(map[string]string, len(value))
+	for name, v := range value {
+		result[name] = fmt.Sprintf("%v", v)
+	}
+
+	return result
+}
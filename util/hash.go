@@ -2,6 +2,8 @@ package util
 
 import (
 	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 
 	"github.com/google/uuid"
@@ -15,3 +17,14 @@ func MD5(key string) string {
 func GenUUID() string {
 	return uuid.New().String()
 }
+
+// GenSessionID returns a cryptographically random session ID
+func GenSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on supported platforms, fall back to uuid just in case
+		return uuid.New().String()
+	}
+
+	return hex.EncodeToString(b)
+}
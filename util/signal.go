@@ -0,0 +1,16 @@
+package util
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WaitForShutdownSignal blocks until the process receives SIGINT or SIGTERM
+func WaitForShutdownSignal() os.Signal {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	return <-quit
+}